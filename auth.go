@@ -0,0 +1,158 @@
+package yarc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenProvider provides the credentials for a request. Token is called
+// for every request so implementations can rotate them, and must be
+// goroutine safe.
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenFunc lets you use a function as a TokenProvider.
+type TokenFunc func(ctx context.Context) (string, error)
+
+// Token calls f(ctx).
+func (f TokenFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// KeyIn is where APIKey sends the key.
+type KeyIn int
+
+const (
+	// InHeader sends the key as a request header.
+	InHeader KeyIn = iota
+	// InQuery sends the key as a query param.
+	InQuery
+)
+
+// BearerToken sends provider's token as "Authorization: Bearer" on every request.
+func BearerToken(provider TokenProvider) optionFunc {
+	return Use(func(next RoundTripFunc) RoundTripFunc {
+		return func(opts Options, req *http.Request) (*http.Response, error) {
+			token, err := provider.Token(req.Context())
+			if err != nil {
+				return nil, authError{fmt.Errorf("error getting bearer token: %w", err)}
+			}
+
+			return next(opts, bearer(opts, req, token))
+		}
+	})
+}
+
+// APIKey sends provider's key on every request as the name header
+// or query param.
+// For example APIKey(InHeader, "X-API-Key", EnvToken("API_KEY")).
+// Query keys are added to the url right before the request is sent,
+// so they are left out of cache keys and rotating them keeps the cache.
+func APIKey(in KeyIn, name string, provider TokenProvider) optionFunc {
+	return Use(func(next RoundTripFunc) RoundTripFunc {
+		return func(opts Options, req *http.Request) (*http.Response, error) {
+			key, err := provider.Token(req.Context())
+			if err != nil {
+				return nil, authError{fmt.Errorf("error getting api key: %w", err)}
+			}
+
+			if in == InQuery {
+				return next(opts, withQueryKey(req, name, key))
+			}
+
+			r := req.Clone(req.Context())
+			r.Header.Set(name, key)
+			return next(opts, r)
+		}
+	})
+}
+
+// queryKeys is the context key for the query params APIKey holds back
+// until the request is sent.
+type queryKeys struct{}
+
+func withQueryKey(req *http.Request, name string, key string) *http.Request {
+	params := url.Values{}
+	if held, ok := req.Context().Value(queryKeys{}).(url.Values); ok {
+		for k, v := range held {
+			params[k] = v
+		}
+	}
+	params.Set(name, key)
+
+	return req.WithContext(context.WithValue(req.Context(), queryKeys{}, params))
+}
+
+// send makes req with the query params APIKey held back.
+func send(opts Options, req *http.Request) (*http.Response, error) {
+	params, ok := req.Context().Value(queryKeys{}).(url.Values)
+	if !ok {
+		return opts.Client.Do(req)
+	}
+
+	r := req.Clone(req.Context())
+	r.URL.RawQuery = strings.TrimPrefix(r.URL.RawQuery+"&"+params.Encode(), "&")
+	return opts.Client.Do(r)
+}
+
+// EnvToken provides the value of the name environment variable.
+// It fails if it's empty.
+func EnvToken(name string) TokenProvider {
+	return TokenFunc(func(ctx context.Context) (string, error) {
+		token := os.Getenv(name)
+		if token == "" {
+			return "", fmt.Errorf("environment variable %s is empty", name)
+		}
+		return token, nil
+	})
+}
+
+// FileToken provides the trimmed content of the file at path.
+// It's read again whenever the file changes, so secrets mounted
+// as files can be rotated.
+func FileToken(path string) TokenProvider {
+	return &fileToken{path: path}
+}
+
+type fileToken struct {
+	lock    sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	token   string
+}
+
+func (f *fileToken) Token(ctx context.Context) (string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.token != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("file %s is empty", f.path)
+	}
+
+	f.token, f.modTime, f.size = token, info.ModTime(), info.Size()
+	return f.token, nil
+}
@@ -0,0 +1,142 @@
+package yarc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Call is the set of option functions for one of GoAll's requests.
+type Call []optionFunc
+
+// Result is the outcome of one of GoAll's calls, as returned by Go.
+type Result struct {
+	Response *http.Response
+	Err      error
+}
+
+// BatchMode tells GoAll what to do when a call fails.
+type BatchMode int
+
+const (
+	// CollectAll runs every call no matter how many of them fail.
+	CollectAll BatchMode = iota
+	// FailFast cancels the calls still running and skips the pending
+	// ones as soon as one of them fails.
+	FailFast
+)
+
+// GoAll makes every call with y and ctx, running at most concurrency of them
+// at a time (0 means all at once). Results are in the same order as calls.
+// The returned error is the first one a call failed with in FailFast mode,
+// CollectAll leaves errors in each Result. Skipped calls fail with
+// context.Canceled, or ctx's error if it's done.
+// Calls share y's options, so they share its cache and middlewares too.
+func (y *Yarc) GoAll(ctx context.Context, calls []Call, concurrency int, mode BatchMode) ([]Result, error) {
+	if concurrency <= 0 || concurrency > len(calls) {
+		concurrency = len(calls)
+	}
+
+	results := make([]Result, len(calls))
+
+	var lock sync.Mutex
+	var first error
+	failed := make(chan struct{})
+	running := make(map[int]context.CancelFunc)
+
+	// fail cancels the calls still running, every other call
+	// keeps its context until its response body is closed.
+	fail := func(err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if first != nil {
+			return
+		}
+		first = err
+		close(failed)
+		for _, cancel := range running {
+			cancel()
+		}
+	}
+
+	skipped := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		select {
+		case <-failed:
+			return context.Canceled
+		default:
+			return nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, call := range calls {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		case <-failed:
+		}
+
+		lock.Lock()
+		err := skipped()
+		callCtx, cancel := context.WithCancel(ctx)
+		if err == nil {
+			running[i] = cancel
+		}
+		lock.Unlock()
+
+		if err != nil {
+			cancel()
+			results[i].Err = err
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, call Call) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			opts := make([]optionFunc, len(call), len(call)+1)
+			copy(opts, call)
+			opts = append(opts, With(Context(callCtx)))
+
+			response, err := y.Go(opts...)
+
+			lock.Lock()
+			delete(running, i)
+			lock.Unlock()
+
+			if response != nil {
+				response.Body = &cancelBody{ReadCloser: response.Body, cancel: cancel}
+			} else {
+				cancel()
+			}
+
+			results[i] = Result{Response: response, Err: err}
+			if err != nil && mode == FailFast {
+				fail(err)
+			}
+		}(i, call)
+	}
+
+	wg.Wait()
+	return results, first
+}
+
+// cancelBody cancels its request's context once it's closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
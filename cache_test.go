@@ -0,0 +1,429 @@
+package yarc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tinchogob/yarc"
+	"github.com/tinchogob/yarc/yams"
+	"github.com/tinchogob/yarc/yasci"
+)
+
+func TestGo_Revalidate(t *testing.T) {
+
+	calls := 0
+	conditionals := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("If-None-Match") == "\"v1\"" {
+			conditionals++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", "\"v1\"")
+		w.Write([]byte("{\"id\":\"123\"}"))
+	}))
+	defer server.Close()
+
+	client, err := yarc.New(
+		yarc.Host(server.URL),
+		yarc.Path("/items/123"),
+		yarc.WithCache(yasci.New(time.Millisecond, 10)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		item := struct {
+			ID string `json:"id"`
+		}{}
+
+		response, err := client.Go(yarc.GET(), yarc.ToJSON(&item, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response.StatusCode != http.StatusOK {
+			t.Errorf("expected status 200 but got %d", response.StatusCode)
+		}
+
+		if item.ID != "123" {
+			t.Errorf("expected (123) but got (%s)", item.ID)
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	if calls != 2 || conditionals != 1 {
+		t.Errorf("expected 2 calls and 1 conditional but got %d and %d", calls, conditionals)
+	}
+}
+
+func TestGo_StaleWhileRevalidate(t *testing.T) {
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Write([]byte(fmt.Sprintf("{\"id\":\"%d\"}", n)))
+	}))
+	defer server.Close()
+
+	client, err := yarc.New(
+		yarc.Host(server.URL),
+		yarc.Path("/items/123"),
+		yarc.WithCache(yasci.New(time.Millisecond*50, 10, yasci.StaleWhileRevalidate(time.Second))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"1", "1", "2"}
+	for i, id := range expected {
+		item := struct {
+			ID string `json:"id"`
+		}{}
+
+		_, err := client.Go(yarc.GET(), yarc.ToJSON(&item, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if item.ID != id {
+			t.Errorf("request %d: expected (%s) but got (%s)", i, id, item.ID)
+		}
+
+		if i == 0 {
+			time.Sleep(time.Millisecond * 60)
+		} else {
+			time.Sleep(time.Millisecond * 20)
+		}
+	}
+
+	if c := atomic.LoadInt32(&calls); c != 2 {
+		t.Errorf("expected 2 calls but got %d", c)
+	}
+}
+
+func TestGo_StaleWhileRevalidateTimeout(t *testing.T) {
+
+	defer yarc.SetRefreshTimeout(30 * time.Millisecond)()
+
+	var calls int32
+	cancelled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			select {
+			case <-r.Context().Done():
+				close(cancelled)
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		w.Write([]byte("{\"id\":\"123\"}"))
+	}))
+	defer server.Close()
+
+	client, err := yarc.New(
+		yarc.Host(server.URL),
+		yarc.Path("/items/123"),
+		yarc.WithCache(yasci.New(time.Millisecond, 10, yasci.StaleWhileRevalidate(time.Second))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Go(yarc.GET()); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(500 * time.Millisecond):
+		t.Errorf("expected the hung background refresh to be cancelled")
+	}
+}
+
+func TestGo_StaleIfError(t *testing.T) {
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("{\"id\":\"123\"}"))
+	}))
+	defer server.Close()
+
+	client, err := yarc.New(
+		yarc.Host(server.URL),
+		yarc.Path("/items/123"),
+		yarc.WithCache(yasci.New(time.Millisecond, 10, yasci.StaleIfError(time.Second))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		item := struct {
+			ID string `json:"id"`
+		}{}
+
+		response, err := client.Go(yarc.GET(), yarc.ToJSON(&item, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response.StatusCode != http.StatusOK || item.ID != "123" {
+			t.Errorf("expected stale (200 123) but got (%d %s)", response.StatusCode, item.ID)
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 calls but got %d", calls)
+	}
+
+	// a fresh response is returned even if storing it fails.
+	calls = -10
+	cache := &failingSet{staleCache: yasci.New(time.Millisecond, 10, yasci.StaleIfError(time.Second))}
+	client, err = yarc.New(yarc.Host(server.URL), yarc.Path("/items/123"), yarc.WithCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Go(yarc.GET()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 5)
+
+	cache.fail = true
+	response, err := client.Go(yarc.GET())
+	if !errors.Is(err, yarc.KindCache) || response == nil || response.Header.Get(yarc.HitHeader) != "" {
+		t.Errorf("expected the fresh response with a cache error but got (%v %v)", response, err)
+	}
+}
+
+type staleCache interface {
+	yarc.Cache
+	yarc.Revalidator
+	yarc.StaleServer
+}
+
+// failingSet is a staleCache whose Set fails once fail is set.
+type failingSet struct {
+	staleCache
+	fail bool
+}
+
+func (c *failingSet) Set(key *http.Request, response *http.Response) error {
+	if c.fail {
+		return errors.New("cache is full")
+	}
+	return c.staleCache.Set(key, response)
+}
+
+func TestGo_Coalesce(t *testing.T) {
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond * 50)
+		w.Write([]byte("{\"id\":\"123\"}"))
+	}))
+	defer server.Close()
+
+	client, err := yarc.New(
+		yarc.Host(server.URL),
+		yarc.Path("/items/123"),
+		yarc.Coalesce(),
+		yarc.WithCache(yasci.New(time.Minute, 10)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg := new(sync.WaitGroup)
+	ids := make([]string, 10)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			item := struct {
+				ID string `json:"id"`
+			}{}
+
+			_, err := client.Go(yarc.GET(), yarc.ToJSON(&item, nil))
+			if err != nil {
+				t.Error(err)
+			}
+			ids[i] = item.ID
+		}(i)
+	}
+	wg.Wait()
+
+	for i, id := range ids {
+		if id != "123" {
+			t.Errorf("request %d: expected (123) but got (%s)", i, id)
+		}
+	}
+
+	if c := atomic.LoadInt32(&calls); c != 1 {
+		t.Errorf("expected 1 call but got %d", c)
+	}
+
+	// a caller giving up doesn't fail the others.
+	client, err = yarc.New(yarc.Host(server.URL), yarc.Path("/items/%s"), yarc.Coalesce())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	errs := make([]error, 2)
+	for i, c := range []context.Context{ctx, context.Background()} {
+		wg.Add(1)
+		go func(i int, c context.Context) {
+			defer wg.Done()
+			_, errs[i] = client.Go(yarc.GET(), yarc.Params("456"), yarc.With(yarc.Context(c)))
+		}(i, c)
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if !errors.Is(errs[0], yarc.KindTimeout) || errs[1] != nil {
+		t.Errorf("expected only the first caller to time out but got (%v %v)", errs[0], errs[1])
+	}
+
+	// requests with different credentials aren't coalesced.
+	atomic.StoreInt32(&calls, 0)
+	for _, token := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			if _, err := client.Go(yarc.GET(), yarc.Params("789"), yarc.Header("Authorization", "Bearer "+token)); err != nil {
+				t.Error(err)
+			}
+		}(token)
+	}
+	wg.Wait()
+
+	if c := atomic.LoadInt32(&calls); c != 2 {
+		t.Errorf("expected 2 calls but got %d", c)
+	}
+}
+
+func TestGo_CachedMetadata(t *testing.T) {
+
+	server, err := yams.New(8181)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.Add(yams.Mock{
+		Method:      http.MethodGet,
+		URL:         "/items",
+		RespStatus:  http.StatusOK,
+		RespHeaders: http.Header{"Content-Type": {"application/json"}, "X-Total": {"42"}, "Age": {"5"}},
+		RespBody:    []byte("[]"),
+	})
+
+	client, err := yarc.New(
+		yarc.Host("http://localhost:8181"),
+		yarc.Path("/items"),
+		yarc.WithCache(yasci.New(time.Minute, 10)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		response, err := client.Go(yarc.GET())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hit := response.Header.Get(yarc.HitHeader) == "hit"
+		if hit != (i == 1) {
+			t.Errorf("request %d: expected hit to be %t", i, i == 1)
+		}
+
+		// upstream's Age is kept, and grows while cached.
+		if age, _ := strconv.Atoi(response.Header.Get("Age")); age < 5 {
+			t.Errorf("request %d: expected Age to be at least 5 but got (%d)", i, age)
+		}
+
+		if response.Status != "200 OK" || response.Proto != "HTTP/1.1" || response.ContentLength != 2 {
+			t.Errorf("request %d: unexpected metadata (%s %s %d)", i, response.Status, response.Proto, response.ContentLength)
+		}
+
+		if response.Header.Get("Content-Type") != "application/json" || response.Header.Get("X-Total") != "42" {
+			t.Errorf("request %d: expected headers to be preserved but got %v", i, response.Header)
+		}
+	}
+}
+
+func TestGo_NegativeCache(t *testing.T) {
+
+	server, err := yams.New(8181)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.Add(yams.Mock{
+		Method:     http.MethodGet,
+		URL:        "/items/404",
+		RespStatus: http.StatusNotFound,
+		RespBody:   []byte("{\"message\":\"item not found\"}"),
+	})
+
+	client, err := yarc.New(
+		yarc.Host("http://localhost:8181"),
+		yarc.Path("/items/%s"),
+		yarc.WithCache(yasci.New(time.Minute, 10, yasci.Negative(time.Second, http.StatusNotFound))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		respBody := struct {
+			Message string `json:"message"`
+		}{}
+
+		response, err := client.Go(yarc.GET(), yarc.Params("404"), yarc.ToJSON(nil, &respBody))
+		if err == nil {
+			t.Fatal("expected a 404 error")
+		}
+
+		if err.Error() != "error 404 GET http://localhost:8181/items/404" {
+			t.Errorf("expected (error 404 GET http://localhost:8181/items/404) but got (%s)", err.Error())
+		}
+
+		if response.StatusCode != http.StatusNotFound || err.(*yarc.Yikes).Body == nil {
+			t.Errorf("expected status 404 and an error body but got %d", response.StatusCode)
+		}
+
+		if respBody.Message != "item not found" {
+			t.Errorf("expected (item not found) but got (%s)", respBody.Message)
+		}
+	}
+}
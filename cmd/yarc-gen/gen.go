@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// locals are the names generated methods use for their own variables
+// and the packages generated files import.
+var locals = map[string]bool{
+	"c": true, "ctx": true, "params": true, "body": true, "opts": true,
+	"result": true, "response": true, "err": true, "ye": true, "v": true, "values": true,
+	"context": true, "errors": true, "fmt": true, "http": true, "url": true, "strings": true, "yarc": true,
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+var methods = []struct {
+	name   string
+	option string
+	op     func(pathItem) *operation
+}{
+	{http.MethodGet, "GET", func(p pathItem) *operation { return p.Get }},
+	{http.MethodPost, "POST", func(p pathItem) *operation { return p.Post }},
+	{http.MethodPut, "PUT", func(p pathItem) *operation { return p.Put }},
+	{http.MethodPatch, "PATCH", func(p pathItem) *operation { return p.Patch }},
+	{http.MethodDelete, "DELETE", func(p pathItem) *operation { return p.Delete }},
+}
+
+// generator writes declarations and keeps track of the imports they need.
+type generator struct {
+	doc     *document
+	decls   bytes.Buffer
+	context bool
+	errors  bool
+	fmt     bool
+	strings bool
+	url     bool
+}
+
+// generate returns the source of a yarc client package for doc.
+func generate(doc *document, pkg string) ([]byte, error) {
+	g := &generator{doc: doc}
+
+	g.schemas()
+	g.client()
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		item := doc.Paths[path]
+		for _, m := range methods {
+			if op := m.op(item); op != nil {
+				if err := g.operation(path, m.name, m.option, item, op); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by yarc-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "// Package %s is a %s client built on yarc.\n", pkg, title(doc))
+	fmt.Fprintf(&src, "package %s\n\nimport (\n", pkg)
+	for _, imp := range []struct {
+		path string
+		used bool
+	}{{"context", g.context}, {"errors", g.errors}, {"fmt", g.fmt}, {"net/http", g.context}, {"net/url", g.url}, {"strings", g.strings}} {
+		if imp.used {
+			fmt.Fprintf(&src, "\t%q\n", imp.path)
+		}
+	}
+	fmt.Fprintf(&src, "\n\t\"github.com/tinchogob/yarc\"\n)\n\n")
+	src.Write(g.decls.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid code: %s", err.Error())
+	}
+
+	return formatted, nil
+}
+
+func title(doc *document) string {
+	if doc.Info.Title == "" {
+		return "REST API"
+	}
+	return doc.Info.Title
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.decls, format, args...)
+}
+
+// schemas declares a type per component schema.
+func (g *generator) schemas() {
+	names := make([]string, 0, len(g.doc.Components.Schemas))
+	for name := range g.doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		g.declare(exported(name), g.doc.Components.Schemas[name])
+	}
+}
+
+// declare adds a type declaration for s.
+func (g *generator) declare(name string, s *schema) {
+	if s.Description != "" {
+		g.printf("// %s %s\n", name, oneLine(s.Description))
+	}
+
+	if s.Ref == "" && len(s.Properties) > 0 {
+		g.printf("type %s %s\n\n", name, g.structType(s))
+		return
+	}
+
+	g.printf("type %s %s\n\n", name, g.goType(s))
+}
+
+// named returns the type for an operation level schema, declaring
+// inline objects as name so signatures stay readable.
+func (g *generator) named(name string, s *schema) string {
+	if s.Ref == "" && len(s.Properties) > 0 {
+		g.declare(name, s)
+		return name
+	}
+	return g.goType(s)
+}
+
+func (g *generator) goType(s *schema) string {
+	if s == nil {
+		return "interface{}"
+	}
+
+	if s.Ref != "" {
+		return exported(s.Ref[strings.LastIndex(s.Ref, "/")+1:])
+	}
+
+	switch s.Type {
+	case "string":
+		return "string"
+	case "integer":
+		if s.Format == "int32" {
+			return "int32"
+		}
+		return "int64"
+	case "number":
+		if s.Format == "float" {
+			return "float32"
+		}
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + g.goType(s.Items)
+	}
+
+	if len(s.Properties) > 0 {
+		return g.structType(s)
+	}
+
+	if s.Type == "object" {
+		return "map[string]interface{}"
+	}
+
+	return "interface{}"
+}
+
+func (g *generator) structType(s *schema) string {
+	required := make(map[string]bool)
+	for _, r := range s.Required {
+		required[r] = true
+	}
+
+	props := make([]string, 0, len(s.Properties))
+	for p := range s.Properties {
+		props = append(props, p)
+	}
+	sort.Strings(props)
+
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, p := range props {
+		tag := p
+		if !required[p] {
+			tag += ",omitempty"
+		}
+		if d := s.Properties[p].Description; d != "" {
+			fmt.Fprintf(&b, "// %s %s\n", exported(p), oneLine(d))
+		}
+		fmt.Fprintf(&b, "%s %s `json:\"%s\"`\n", exported(p), g.goType(s.Properties[p]), tag)
+	}
+	b.WriteString("}")
+
+	return b.String()
+}
+
+func (g *generator) client() {
+	g.printf("// Client is a %s client built on yarc.\n", title(g.doc))
+	g.printf("type Client struct {\n\ty *yarc.Yarc\n}\n\n")
+	g.printf("// New returns a Client that makes its requests with y.\n")
+	g.printf("// y should be created with at least the API Host.\n")
+	g.printf("func New(y *yarc.Yarc) *Client {\n\treturn &Client{y: y}\n}\n\n")
+}
+
+type errorType struct {
+	name string
+	code string
+	lo   int
+	hi   int
+	typ  string
+	v    string
+}
+
+// operation declares the method, params and error types of op.
+func (g *generator) operation(path string, method string, option string, item pathItem, op *operation) error {
+	name := operationName(path, method, op)
+	g.context = true
+
+	pathLevel, err := g.resolve(item.Parameters)
+	if err != nil {
+		return fmt.Errorf("%s %s: %s", method, path, err.Error())
+	}
+	opLevel, err := g.resolve(op.Parameters)
+	if err != nil {
+		return fmt.Errorf("%s %s: %s", method, path, err.Error())
+	}
+
+	var pathParams, otherParams []parameter
+	for _, p := range mergeParams(pathLevel, opLevel) {
+		switch p.In {
+		case "path":
+			pathParams = append(pathParams, p)
+		case "query", "header":
+			otherParams = append(otherParams, p)
+		}
+	}
+
+	// path params go as arguments in the order they show up in the path
+	var args []string
+	var values []string
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		p, ok := find(pathParams, m[1])
+		if !ok {
+			return fmt.Errorf("%s %s: path param %s is not declared", method, path, m[1])
+		}
+		arg := unexported(p.Name, locals)
+		args = append(args, fmt.Sprintf("%s %s", arg, g.goType(p.Schema)))
+		// escaped so values with / or ? don't change the url
+		g.url = true
+		values = append(values, fmt.Sprintf("url.PathEscape(%s)", g.stringOf(arg, p.Schema)))
+	}
+	yarcPath := pathParam.ReplaceAllString(path, "%s")
+
+	paramsType := name + "Params"
+	if len(otherParams) > 0 {
+		g.printf("// %s are the query and header params of %s.\n", paramsType, name)
+		g.printf("// Optional params are only sent if not nil, array query params\n")
+		g.printf("// are sent once per item.\n")
+		g.printf("type %s struct {\n", paramsType)
+		for _, p := range otherParams {
+			typ := g.goType(p.Schema)
+			if !p.Required && !isArray(p.Schema) {
+				typ = "*" + typ
+			}
+			g.printf("%s %s\n", exported(p.Name), typ)
+		}
+		g.printf("}\n\n")
+		args = append(args, "params "+paramsType)
+	}
+
+	hasBody := false
+	if op.RequestBody != nil {
+		if s := jsonSchema(op.RequestBody.Content); s != nil {
+			args = append(args, "body "+g.named(name+"Body", s))
+			hasBody = true
+		}
+	}
+
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	result := ""
+	var errs []errorType
+	for _, code := range codes {
+		s := jsonSchema(op.Responses[code].Content)
+		if s == nil {
+			continue
+		}
+
+		lo, hi, ok := statusRange(code)
+		if ok && lo >= 200 && hi < 300 {
+			if result == "" {
+				result = g.named(name+"Response", s)
+			}
+			continue
+		}
+
+		suffix := strings.ToUpper(code)
+		if !ok {
+			suffix = "Default"
+		}
+		e := errorType{name: name + suffix + "Error", code: code, lo: lo, hi: hi, v: "err" + suffix}
+		e.typ = g.named(name+suffix+"Problem", s)
+		errs = append(errs, e)
+	}
+
+	for _, e := range errs {
+		if e.code == "default" {
+			g.printf("// %s is returned by %s when upstream answers with an undocumented unsuccessful status.\n", e.name, name)
+		} else {
+			g.printf("// %s is returned by %s when upstream answers with a %s.\n", e.name, name, e.code)
+		}
+		g.printf("type %s struct {\n\t*yarc.Yikes\n\tBody %s\n}\n\n", e.name, e.typ)
+		g.printf("// Unwrap returns the underlying Yikes.\n")
+		g.printf("func (e *%s) Unwrap() error {\n\treturn e.Yikes\n}\n\n", e.name)
+	}
+
+	// method
+	summary := op.Summary
+	if summary == "" {
+		summary = fmt.Sprintf("calls %s %s.", method, path)
+	}
+	g.printf("// %s %s\n", name, oneLine(summary))
+
+	returns := "(*http.Response, error)"
+	if result != "" {
+		returns = fmt.Sprintf("(%s, *http.Response, error)", result)
+	}
+	g.printf("func (c *Client) %s(ctx context.Context", name)
+	for _, a := range args {
+		g.printf(", %s", a)
+	}
+	g.printf(") %s {\n", returns)
+
+	if result != "" {
+		g.printf("var result %s\n", result)
+	}
+	var defaultErr string
+	for _, e := range errs {
+		g.printf("var %s %s\n", e.v, e.typ)
+		if e.code == "default" {
+			defaultErr = "&" + e.v
+		}
+	}
+
+	g.printf("opts := []yarc.OptionFunc{\n")
+	g.printf("yarc.Name(%q),\n", name)
+	g.printf("yarc.%s(),\n", option)
+	g.printf("yarc.Path(%q),\n", yarcPath)
+	if len(values) > 0 {
+		g.printf("yarc.Params(%s),\n", strings.Join(values, ", "))
+	}
+	g.printf("yarc.With(yarc.Context(ctx)),\n")
+	for _, e := range errs {
+		switch {
+		case e.code == "default":
+		case e.lo == e.hi:
+			g.printf("yarc.OnStatus(%d, &%s),\n", e.lo, e.v)
+		default:
+			g.printf("yarc.OnStatusRange(%d, %d, &%s),\n", e.lo, e.hi, e.v)
+		}
+	}
+	if result != "" || len(errs) > 0 {
+		target := "nil"
+		if result != "" {
+			target = "&result"
+		}
+		if defaultErr == "" {
+			defaultErr = "nil"
+		}
+		g.printf("yarc.ToJSON(%s, %s),\n", target, defaultErr)
+	}
+	g.printf("}\n")
+
+	for _, p := range otherParams {
+		field := "params." + exported(p.Name)
+		if isArray(p.Schema) {
+			g.arrayParam(p, field)
+			continue
+		}
+
+		value := field
+		if !p.Required {
+			value = "*" + field
+			g.printf("if %s != nil {\n", field)
+		}
+		opt := "Query"
+		if p.In == "header" {
+			opt = "Header"
+		}
+		g.printf("opts = append(opts, yarc.%s(%q, %s))\n", opt, p.Name, g.stringOf(value, p.Schema))
+		if !p.Required {
+			g.printf("}\n")
+		}
+	}
+
+	if hasBody {
+		g.printf("opts = append(opts, yarc.JSON(body))\n")
+	}
+
+	g.printf("response, err := c.y.Go(opts...)\n")
+
+	ret := "response"
+	if result != "" {
+		ret = "result, response"
+	}
+
+	if len(errs) > 0 {
+		g.errors = true
+		g.printf("var ye *yarc.Yikes\n")
+		g.printf("if errors.As(err, &ye) && ye.Kind == yarc.KindStatus {\n")
+		g.printf("switch {\n")
+		var fallback *errorType
+		for i, e := range errs {
+			switch {
+			case e.code == "default":
+				fallback = &errs[i]
+				continue
+			case e.lo == e.hi:
+				g.printf("case ye.StatusCode == %d:\n", e.lo)
+			default:
+				g.printf("case ye.StatusCode >= %d && ye.StatusCode <= %d:\n", e.lo, e.hi)
+			}
+			g.printf("return %s, &%s{Yikes: ye, Body: %s}\n", ret, e.name, e.v)
+		}
+		if fallback != nil {
+			g.printf("default:\n")
+			g.printf("return %s, &%s{Yikes: ye, Body: %s}\n", ret, fallback.name, fallback.v)
+		}
+		g.printf("}\n}\n")
+	}
+
+	g.printf("return %s, err\n}\n\n", ret)
+
+	return nil
+}
+
+// arrayParam appends the options that send the array param p, held in field.
+// Query params are repeated once per item, headers are comma separated.
+func (g *generator) arrayParam(p parameter, field string) {
+	item := g.stringOf("v", p.Schema.Items)
+	if p.In == "query" {
+		g.printf("for _, v := range %s {\n", field)
+		g.printf("opts = append(opts, yarc.Query(%q, %s))\n", p.Name, item)
+		g.printf("}\n")
+		return
+	}
+
+	g.strings = true
+	g.printf("if len(%s) > 0 {\n", field)
+	g.printf("values := make([]string, 0, len(%s))\n", field)
+	g.printf("for _, v := range %s {\n", field)
+	g.printf("values = append(values, %s)\n", item)
+	g.printf("}\n")
+	g.printf("opts = append(opts, yarc.Header(%q, strings.Join(values, \",\")))\n", p.Name)
+	g.printf("}\n")
+}
+
+func isArray(s *schema) bool {
+	return s != nil && s.Type == "array"
+}
+
+// stringOf returns the expression that turns v, of schema s, into a string.
+func (g *generator) stringOf(v string, s *schema) string {
+	if g.goType(s) == "string" {
+		return v
+	}
+	g.fmt = true
+	return fmt.Sprintf("fmt.Sprint(%s)", v)
+}
+
+func operationName(path string, method string, op *operation) string {
+	if op.OperationID != "" {
+		return exported(op.OperationID)
+	}
+
+	name := exported(strings.ToLower(method))
+	for _, segment := range strings.Split(path, "/") {
+		if m := pathParam.FindStringSubmatch(segment); m != nil {
+			name += "By" + exported(m[1])
+		} else if segment != "" {
+			name += exported(segment)
+		}
+	}
+	return name
+}
+
+// resolve returns params with references to component params replaced
+// by what they point to. It fails for references it can't resolve so
+// that no param is silently left out.
+func (g *generator) resolve(params []parameter) ([]parameter, error) {
+	resolved := make([]parameter, 0, len(params))
+	for _, p := range params {
+		if p.Ref != "" {
+			name := strings.TrimPrefix(p.Ref, "#/components/parameters/")
+			target, ok := g.doc.Components.Parameters[name]
+			if name == p.Ref || !ok || target.Ref != "" {
+				return nil, fmt.Errorf("can't resolve param %s", p.Ref)
+			}
+			p = target
+		}
+		resolved = append(resolved, p)
+	}
+	return resolved, nil
+}
+
+// mergeParams returns path level params overridden by operation level ones.
+func mergeParams(pathLevel []parameter, opLevel []parameter) []parameter {
+	params := make([]parameter, 0, len(pathLevel)+len(opLevel))
+	for _, p := range pathLevel {
+		if _, ok := findIn(opLevel, p.Name, p.In); !ok {
+			params = append(params, p)
+		}
+	}
+	return append(params, opLevel...)
+}
+
+func find(params []parameter, name string) (parameter, bool) {
+	return findIn(params, name, "path")
+}
+
+func findIn(params []parameter, name string, in string) (parameter, bool) {
+	for _, p := range params {
+		if p.Name == name && p.In == in {
+			return p, true
+		}
+	}
+	return parameter{}, false
+}
+
+// statusRange parses a response code such as 404 or 4XX.
+// It reports false for default.
+func statusRange(code string) (int, int, bool) {
+	if len(code) == 3 && strings.HasSuffix(strings.ToUpper(code), "XX") {
+		class, err := strconv.Atoi(code[:1])
+		if err != nil {
+			return 0, 0, false
+		}
+		return class * 100, class*100 + 99, true
+	}
+
+	status, err := strconv.Atoi(code)
+	if err != nil {
+		return 0, 0, false
+	}
+	return status, status, true
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/petstore.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := &document{}
+	if err := json.Unmarshal(b, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	src, file := compile(t, doc, "petstore")
+
+	var decls []string
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil {
+				name = "." + name
+			}
+			decls = append(decls, name)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					decls = append(decls, ts.Name.Name)
+				}
+			}
+		}
+	}
+	sort.Strings(decls)
+
+	expected := []string{
+		".CreatePet", ".DeletePetsByPetID", ".ListPets", ".ShowPetByID",
+		".Unwrap", ".Unwrap", ".Unwrap", ".Unwrap",
+		"Client", "CreatePet422Error", "CreatePet422Problem", "CreatePet5XXError", "CreatePetBody",
+		"Error", "ListPetsDefaultError", "ListPetsParams", "New", "Pet", "Pets", "ShowPetByID404Error",
+	}
+
+	if strings.Join(decls, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected (%v) but got (%v)", expected, decls)
+	}
+
+	for _, snippet := range []string{
+		`yarc.Path("/pets/%s")`,
+		`yarc.Params(url.PathEscape(fmt.Sprint(petID)))`,
+		`yarc.Query("limit", fmt.Sprint(*params.Limit))`,
+		`yarc.Header("X-Request-ID", params.XRequestID)`,
+		`yarc.OnStatusRange(500, 599, &err5XX)`,
+		`opts = append(opts, yarc.Query("tags", v))`,
+		`yarc.Header("X-Features", strings.Join(values, ","))`,
+		`yarc.ToJSON(&result, &errDefault)`,
+	} {
+		if !strings.Contains(string(src), snippet) {
+			t.Errorf("expected generated code to contain (%s)", snippet)
+		}
+	}
+}
+
+func TestGenerate_ParamNames(t *testing.T) {
+	doc := &document{}
+	err := json.Unmarshal([]byte(`{
+		"openapi": "3.0.0",
+		"paths": {
+			"/links/{url}/{fmt}/{errors}/{yarc}": {
+				"get": {
+					"operationId": "getLink",
+					"parameters": [
+						{"name": "url", "in": "path", "required": true, "schema": {"type": "integer"}},
+						{"name": "fmt", "in": "path", "required": true, "schema": {"type": "string"}},
+						{"name": "errors", "in": "path", "required": true, "schema": {"type": "string"}},
+						{"name": "yarc", "in": "path", "required": true, "schema": {"type": "string"}},
+						{"name": "strings", "in": "header", "schema": {"type": "array", "items": {"type": "integer"}}}
+					],
+					"responses": {"404": {"description": "not found", "content": {"application/json": {"schema": {"type": "string"}}}}}
+				}
+			}
+		}
+	}`), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, _ := compile(t, doc, "links")
+
+	if !strings.Contains(string(src), `yarc.Params(url.PathEscape(fmt.Sprint(urlParam)), url.PathEscape(fmtParam)`) {
+		t.Errorf("expected params not to shadow imported packages but got\n%s", string(src))
+	}
+}
+
+func TestGenerate_UnresolvedParam(t *testing.T) {
+	doc := &document{}
+	err := json.Unmarshal([]byte(`{
+		"openapi": "3.0.0",
+		"paths": {
+			"/pets": {
+				"get": {
+					"parameters": [{"$ref": "#/components/parameters/Missing"}],
+					"responses": {"204": {"description": "ok"}}
+				}
+			}
+		}
+	}`), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := generate(doc, "petstore"); err == nil || !strings.Contains(err.Error(), "#/components/parameters/Missing") {
+		t.Errorf("expected an error for the unresolved param but got (%v)", err)
+	}
+}
+
+// compile generates pkg out of doc and type checks it against yarc's
+// source so it's known to compile.
+func compile(t *testing.T, doc *document, pkg string) ([]byte, *ast.File) {
+	src, err := generate(doc, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "client.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated code doesn't parse: %s\n%s", err.Error(), string(src))
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check(pkg, fset, []*ast.File{file}, nil); err != nil {
+		t.Fatalf("generated code doesn't compile: %s\n%s", err.Error(), string(src))
+	}
+
+	return src, file
+}
+
+func TestNames(t *testing.T) {
+	cases := []struct {
+		in         string
+		exported   string
+		unexported string
+	}{
+		{in: "petId", exported: "PetID", unexported: "petID"},
+		{in: "X-Request-ID", exported: "XRequestID", unexported: "xRequestID"},
+		{in: "showPetById", exported: "ShowPetByID", unexported: "showPetByID"},
+		{in: "HTTPServer", exported: "HTTPServer", unexported: "httpServer"},
+		{in: "type", exported: "Type", unexported: "typeParam"},
+		{in: "2fa_code", exported: "X2faCode", unexported: "x2faCode"},
+		{in: "url", exported: "URL", unexported: "urlParam"},
+		{in: "yarc", exported: "Yarc", unexported: "yarcParam"},
+	}
+
+	for _, c := range cases {
+		if got := exported(c.in); got != c.exported {
+			t.Errorf("exported(%s): expected (%s) but got (%s)", c.in, c.exported, got)
+		}
+		if got := unexported(c.in, locals); got != c.unexported {
+			t.Errorf("unexported(%s): expected (%s) but got (%s)", c.in, c.unexported, got)
+		}
+	}
+}
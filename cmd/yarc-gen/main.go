@@ -0,0 +1,59 @@
+// yarc-gen generates a yarc based Go client from an OpenAPI 3 document.
+//
+// Usage:
+//
+//	yarc-gen -spec openapi.json -pkg petstore -out petstore/client.go
+//
+// The generated package has one Client method per operation, typed
+// request/response structs for every schema and one error type per
+// documented unsuccessful status. Only JSON documents are supported.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+func main() {
+	spec := flag.String("spec", "", "OpenAPI 3 document (JSON)")
+	pkg := flag.String("pkg", "client", "generated package name")
+	out := flag.String("out", "", "output file, stdout if empty")
+	flag.Parse()
+
+	if *spec == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*spec, *pkg, *out); err != nil {
+		fmt.Fprintf(os.Stderr, "yarc-gen: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(spec string, pkg string, out string) error {
+	b, err := ioutil.ReadFile(spec)
+	if err != nil {
+		return err
+	}
+
+	doc := &document{}
+	if err := json.Unmarshal(b, doc); err != nil {
+		return fmt.Errorf("%s is not a JSON OpenAPI document: %s", spec, err.Error())
+	}
+
+	src, err := generate(doc, pkg)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+
+	return ioutil.WriteFile(out, src, 0644)
+}
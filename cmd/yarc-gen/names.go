@@ -0,0 +1,87 @@
+package main
+
+import (
+	"go/token"
+	"strings"
+	"unicode"
+)
+
+var initialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true,
+	"JSON": true, "SQL": true, "URI": true, "URL": true, "UUID": true, "XML": true,
+}
+
+// words splits s by non alphanumerics and camel case humps.
+func words(s string) []string {
+	var words []string
+	var current []rune
+	runes := []rune(s)
+
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(current) > 0 {
+				words = append(words, string(current))
+				current = nil
+			}
+			continue
+		}
+
+		if unicode.IsUpper(r) && len(current) > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				words = append(words, string(current))
+				current = nil
+			}
+		}
+
+		current = append(current, r)
+	}
+
+	if len(current) > 0 {
+		words = append(words, string(current))
+	}
+
+	return words
+}
+
+// exported turns s into an exported Go identifier.
+func exported(s string) string {
+	var b strings.Builder
+	for _, w := range words(s) {
+		if initialisms[strings.ToUpper(w)] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(strings.ToLower(w))
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+
+	name := b.String()
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "X" + name
+	}
+
+	return name
+}
+
+// unexported turns s into an unexported Go identifier
+// that doesn't clash with keywords or reserved names.
+func unexported(s string, reserved map[string]bool) string {
+	ws := words(s)
+	if len(ws) == 0 {
+		return "x"
+	}
+
+	name := strings.ToLower(ws[0]) + strings.TrimPrefix(exported(strings.Join(ws, " ")), exported(ws[0]))
+	if unicode.IsDigit([]rune(name)[0]) {
+		name = "x" + name
+	}
+
+	if token.IsKeyword(name) || reserved[name] {
+		name += "Param"
+	}
+
+	return name
+}
@@ -0,0 +1,78 @@
+package main
+
+// The subset of an OpenAPI 3 document yarc-gen understands.
+
+type document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       info                `json:"info"`
+	Paths      map[string]pathItem `json:"paths"`
+	Components components          `json:"components"`
+}
+
+type info struct {
+	Title string `json:"title"`
+}
+
+type components struct {
+	Schemas    map[string]*schema   `json:"schemas"`
+	Parameters map[string]parameter `json:"parameters"`
+}
+
+type pathItem struct {
+	Parameters []parameter `json:"parameters"`
+	Get        *operation  `json:"get"`
+	Put        *operation  `json:"put"`
+	Post       *operation  `json:"post"`
+	Delete     *operation  `json:"delete"`
+	Patch      *operation  `json:"patch"`
+}
+
+type operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Parameters  []parameter         `json:"parameters"`
+	RequestBody *requestBody        `json:"requestBody"`
+	Responses   map[string]response `json:"responses"`
+}
+
+type parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref         string             `json:"$ref"`
+	Type        string             `json:"type"`
+	Format      string             `json:"format"`
+	Description string             `json:"description"`
+	Properties  map[string]*schema `json:"properties"`
+	Required    []string           `json:"required"`
+	Items       *schema            `json:"items"`
+}
+
+// jsonSchema returns the schema of the JSON media type in content, if any.
+func jsonSchema(content map[string]mediaType) *schema {
+	for _, t := range []string{"application/json", "application/problem+json"} {
+		if m, ok := content[t]; ok && m.Schema != nil {
+			return m.Schema
+		}
+	}
+	return nil
+}
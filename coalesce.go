@@ -0,0 +1,122 @@
+package yarc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// flights deduplicates in-flight identical requests.
+// The shared request runs on its own, so no single caller can
+// cancel it, and every caller gets its own copy of the response.
+type flights struct {
+	lock  *sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done     chan struct{}
+	waiters  int
+	cancel   context.CancelFunc
+	response *http.Response
+	body     []byte
+	err      error
+}
+
+func newFlights() *flights {
+	return &flights{
+		lock:  new(sync.Mutex),
+		calls: make(map[string]*flight),
+	}
+}
+
+// do runs fn once for every concurrent caller with the same key and waits
+// for it until ctx is done. fn gets a context that keeps ctx's values but
+// not its cancellation, and is cancelled once every caller gave up.
+func (f *flights) do(ctx context.Context, key string, fn func(ctx context.Context) (*http.Response, error)) (*http.Response, error) {
+	f.lock.Lock()
+	c, ok := f.calls[key]
+	if !ok {
+		shared, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &flight{done: make(chan struct{}), cancel: cancel}
+		f.calls[key] = c
+		go f.run(shared, key, c, fn)
+	}
+	c.waiters++
+	f.lock.Unlock()
+
+	select {
+	case <-c.done:
+		return c.copy()
+	case <-ctx.Done():
+		f.lock.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			if f.calls[key] == c {
+				delete(f.calls, key)
+			}
+		}
+		f.lock.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (f *flights) run(ctx context.Context, key string, c *flight, fn func(ctx context.Context) (*http.Response, error)) {
+	c.response, c.err = fn(ctx)
+	if c.response != nil {
+		body, err := ioutil.ReadAll(c.response.Body)
+		c.response.Body.Close()
+		if err != nil && c.err == nil {
+			c.err = err
+		}
+		c.body = body
+	}
+
+	f.lock.Lock()
+	if f.calls[key] == c {
+		delete(f.calls, key)
+	}
+	f.lock.Unlock()
+
+	c.cancel()
+	close(c.done)
+}
+
+func (c *flight) copy() (*http.Response, error) {
+	if c.response == nil {
+		return nil, c.err
+	}
+
+	response := *c.response
+	response.Header = c.response.Header.Clone()
+	response.Body = ioutil.NopCloser(bytes.NewReader(c.body))
+
+	return &response, c.err
+}
+
+// flightKey identifies identical requests by method, URL, headers and
+// APIKey query keys, so requests with different credentials never share
+// a response.
+func flightKey(req *http.Request) string {
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	key.WriteString(req.Method + " " + req.URL.String())
+	for _, name := range names {
+		key.WriteString("\n" + name + ": " + strings.Join(req.Header[name], ", "))
+	}
+	if params, ok := req.Context().Value(queryKeys{}).(url.Values); ok {
+		key.WriteString("\n" + params.Encode())
+	}
+	return key.String()
+}
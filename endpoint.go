@@ -0,0 +1,49 @@
+package yarc
+
+import (
+	"context"
+	"net/http"
+)
+
+// NoBody is the Req of endpoints that send no request body.
+type NoBody struct{}
+
+// Endpoint is a reusable typed call to one upstream endpoint.
+// It bundles its own option functions (method, path, headers, query,
+// cache policy, etc) on top of the Yarc it was created from.
+type Endpoint[Req, Res, E any] struct {
+	y    *Yarc
+	opts []optionFunc
+}
+
+// NewEndpoint returns an Endpoint that makes requests with y and optsFunc.
+// Its requests are labeled with name (see Name) for metrics.
+//
+//	getItem := yarc.NewEndpoint[yarc.NoBody, Item, ApiError](client, "get_item",
+//		GET(),
+//		Path("/items/%s"),
+//		WithCache(yasci.New(time.Minute, 1000)),
+//	)
+//	item, _, err := getItem.Call(ctx, yarc.NoBody{}, "123")
+func NewEndpoint[Req, Res, E any](y *Yarc, name string, optsFunc ...optionFunc) *Endpoint[Req, Res, E] {
+	opts := make([]optionFunc, 0, len(optsFunc)+1)
+	opts = append(opts, Name(name))
+	opts = append(opts, optsFunc...)
+
+	return &Endpoint[Req, Res, E]{y: y, opts: opts}
+}
+
+// Call makes the request with ctx, replacing every %s in the endpoint path
+// with params. req is sent as JSON unless Req is NoBody.
+// Responses and errors are decoded as in Do.
+func (e *Endpoint[Req, Res, E]) Call(ctx context.Context, req Req, params ...string) (Res, *http.Response, error) {
+	opts := make([]optionFunc, len(e.opts), len(e.opts)+3)
+	copy(opts, e.opts)
+	opts = append(opts, Params(params...), With(Context(ctx)))
+
+	if _, ok := any(req).(NoBody); !ok {
+		opts = append(opts, JSON(req))
+	}
+
+	return Do[Res, E](e.y, opts...)
+}
@@ -1,4 +1,4 @@
-package yarc
+package yarc_test
 
 import (
 	"context"
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/tinchogob/yarc"
 	"github.com/tinchogob/yarc/yams"
 	"github.com/tinchogob/yarc/yasci"
 )
@@ -30,15 +31,15 @@ func ExampleYarc() {
 		},
 	)
 
-	yarc, err := New(
-		Client(BaseClient(1, time.Second, time.Second)),
-		Host("http://127.0.0.1:8181"),
-		Path("/items/%s/ping/%s"),
-		Header("Connection", "keep-alive"),
-		Header("Cache-Control", "no-cache"),
-		Trace(BaseTrace()),
-		With(Debug(os.Stdout)),
-		WithCache(yasci.New(time.Millisecond*100, 100)),
+	client, err := yarc.New(
+		yarc.Client(yarc.BaseClient(1, time.Second, time.Second)),
+		yarc.Host("http://127.0.0.1:8181"),
+		yarc.Path("/items/%s/ping/%s"),
+		yarc.Header("Connection", "keep-alive"),
+		yarc.Header("Cache-Control", "no-cache"),
+		yarc.Trace(yarc.BaseTrace()),
+		yarc.With(yarc.Debug(os.Stdout)),
+		yarc.WithCache(yasci.New(time.Millisecond*100, 100)),
 	)
 
 	if err != nil {
@@ -67,14 +68,14 @@ func ExampleYarc() {
 				ID string `json:"id"`
 			}{}
 
-			res, err := yarc.Go(
-				POST(),
-				Header("X-Name", "Martin"),
-				JSON(body),
-				Params("1", "2"),
-				Query("attributes", "id"),
-				With(Context(context.Background())),
-				ToJSON(resp, errBody),
+			res, err := client.Go(
+				yarc.POST(),
+				yarc.Header("X-Name", "Martin"),
+				yarc.JSON(body),
+				yarc.Params("1", "2"),
+				yarc.Query("attributes", "id"),
+				yarc.With(yarc.Context(context.Background())),
+				yarc.ToJSON(resp, errBody),
 			)
 
 			wg.Done()
@@ -0,0 +1,11 @@
+package yarc
+
+import "time"
+
+// SetRefreshTimeout sets refreshTimeout for external tests and returns
+// a func that restores it.
+func SetRefreshTimeout(timeout time.Duration) func() {
+	previous := refreshTimeout
+	refreshTimeout = timeout
+	return func() { refreshTimeout = previous }
+}
@@ -0,0 +1,122 @@
+package yarc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+type hedging struct {
+	delay time.Duration
+	max   int
+}
+
+// hedgeKey marks every attempt of a hedged request so they skip
+// coalescing, otherwise they'd join each other or other callers'
+// requests and cancelling a loser would cancel those too.
+type hedgeKey struct{}
+
+type attempt struct {
+	i        int
+	response *http.Response
+	err      error
+}
+
+// Hedge makes idempotent requests (GET, HEAD, OPTIONS, PUT, DELETE) fire a
+// duplicate every delay the previous ones haven't returned, up to max
+// attempts in total. Go returns whichever finishes first and cancels the
+// others. An attempt that failed without a response is only returned if
+// no other one is in flight, Hedge doesn't retry (see Use for that).
+// Every attempt counts in Yikes.Attempts.
+// You should use it with a pooled Client (see BaseClient) so duplicates
+// are cheap.
+func Hedge(delay time.Duration, max int) optionFunc {
+	return func(opts Options) (Options, error) {
+		opts.hedge = &hedging{delay: delay, max: max}
+		return opts, nil
+	}
+}
+
+// wrap returns a RoundTripFunc that hedges next.
+func (h *hedging) wrap(next RoundTripFunc) RoundTripFunc {
+	return func(opts Options, req *http.Request) (*http.Response, error) {
+		if h.max < 2 || !idempotent(req.Method) {
+			return next(opts, req)
+		}
+
+		attempts := make(chan attempt, h.max)
+		cancels := make([]context.CancelFunc, 0, h.max)
+		launch := func() {
+			i := len(cancels)
+			ctx, cancel := context.WithCancel(context.WithValue(req.Context(), hedgeKey{}, i))
+			cancels = append(cancels, cancel)
+
+			r := req.Clone(ctx)
+			r.Body = ioutil.NopCloser(bytes.NewReader(opts.ReqBody))
+			go func() {
+				response, err := next(opts, r)
+				attempts <- attempt{i: i, response: response, err: err}
+			}()
+		}
+
+		launch()
+		timer := time.NewTimer(h.delay)
+		defer timer.Stop()
+
+		pending := 1
+		for {
+			select {
+			case <-timer.C:
+				if len(cancels) < h.max {
+					launch()
+					pending++
+					timer.Reset(h.delay)
+				}
+
+			case a := <-attempts:
+				pending--
+				// an attempt with a response wins even if it failed
+				// afterwards (i.e. on Cache.Set), as Go returns both.
+				if a.response == nil {
+					cancels[a.i]()
+					if pending > 0 {
+						continue
+					}
+					return nil, a.err
+				}
+
+				for i, cancel := range cancels {
+					if i != a.i {
+						cancel()
+					}
+				}
+				go discard(attempts, pending)
+
+				a.response.Body = &cancelBody{ReadCloser: a.response.Body, cancel: cancels[a.i]}
+				return a.response, a.err
+			}
+		}
+	}
+}
+
+// discard closes the responses of n losing attempts.
+func discard(attempts chan attempt, n int) {
+	for ; n > 0; n-- {
+		a := <-attempts
+		if a.response != nil {
+			io.Copy(ioutil.Discard, a.response.Body)
+			a.response.Body.Close()
+		}
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
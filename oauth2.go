@@ -0,0 +1,170 @@
+package yarc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauth2Skew makes tokens expire a bit earlier than told,
+// so they don't expire on their way upstream.
+const oauth2Skew = 10 * time.Second
+
+type oauth2Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// oauth2Source fetches access tokens from tokenURL and
+// caches them until they expire.
+type oauth2Source struct {
+	lock     sync.Mutex
+	tokenURL string
+	id       string
+	secret   string
+	grant    url.Values
+	access   string
+	expiry   time.Time
+}
+
+// OAuth2ClientCredentials authenticates requests with an OAuth2 client
+// credentials grant. Access tokens are fetched from tokenURL with yarc,
+// sent as "Authorization: Bearer" and cached until they expire. When
+// upstream answers 401 the token is fetched again and the request
+// retried once.
+// Tokens are fetched with the request's Client.
+// You should use it in New so that every request shares the same token.
+func OAuth2ClientCredentials(tokenURL string, id string, secret string, scopes ...string) optionFunc {
+	grant := url.Values{"grant_type": {"client_credentials"}}
+	if len(scopes) > 0 {
+		grant.Set("scope", strings.Join(scopes, " "))
+	}
+
+	return Use(newOAuth2Source(tokenURL, id, secret, grant).middleware)
+}
+
+// OAuth2RefreshToken authenticates requests like OAuth2ClientCredentials
+// does but with an OAuth2 refresh token grant. If the token endpoint
+// rotates refreshToken the new one is used from then on.
+func OAuth2RefreshToken(tokenURL string, id string, secret string, refreshToken string) optionFunc {
+	grant := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	}
+
+	return Use(newOAuth2Source(tokenURL, id, secret, grant).middleware)
+}
+
+func newOAuth2Source(tokenURL string, id string, secret string, grant url.Values) *oauth2Source {
+	return &oauth2Source{
+		tokenURL: tokenURL,
+		id:       id,
+		secret:   secret,
+		grant:    grant,
+	}
+}
+
+func (s *oauth2Source) middleware(next RoundTripFunc) RoundTripFunc {
+	return func(opts Options, req *http.Request) (*http.Response, error) {
+		access, err := s.token(opts, req.Context())
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := next(opts, bearer(opts, req, access))
+		if err != nil || response.StatusCode != http.StatusUnauthorized {
+			return response, err
+		}
+
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		s.invalidate(access)
+
+		access, err = s.token(opts, req.Context())
+		if err != nil {
+			return nil, err
+		}
+
+		return next(opts, bearer(opts, req, access))
+	}
+}
+
+// token returns the cached access token or fetches a new one.
+func (s *oauth2Source) token(opts Options, ctx context.Context) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.access != "" && (s.expiry.IsZero() || time.Now().Before(s.expiry)) {
+		return s.access, nil
+	}
+
+	y, err := New(Client(opts.Client))
+	if err != nil {
+		return "", err
+	}
+
+	token := &oauth2Token{}
+	_, err = y.Go(
+		POST(),
+		Path(s.tokenURL),
+		Header("Content-Type", "application/x-www-form-urlencoded"),
+		Body([]byte(s.grant.Encode())),
+		With(BasicAuth(url.QueryEscape(s.id), url.QueryEscape(s.secret))),
+		With(Context(ctx)),
+		ToJSON(token, nil),
+	)
+	// the token endpoint's Yikes isn't wrapped so that its kind
+	// and status aren't mistaken for the request's.
+	if err != nil {
+		return "", authError{fmt.Errorf("error fetching oauth2 token: %s", err.Error())}
+	}
+
+	if token.AccessToken == "" {
+		return "", authError{fmt.Errorf("error fetching oauth2 token: no access_token in response")}
+	}
+
+	s.access = token.AccessToken
+	s.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		s.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - oauth2Skew)
+	}
+
+	if token.RefreshToken != "" && s.grant.Get("grant_type") == "refresh_token" {
+		grant := url.Values{}
+		for k, v := range s.grant {
+			grant[k] = v
+		}
+		grant.Set("refresh_token", token.RefreshToken)
+		s.grant = grant
+	}
+
+	return s.access, nil
+}
+
+// invalidate drops access if it's still the cached token.
+func (s *oauth2Source) invalidate(access string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.access == access {
+		s.access = ""
+	}
+}
+
+// bearer returns a copy of req authorized with token, with its own
+// body so it can be sent again.
+func bearer(opts Options, req *http.Request, token string) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Body = ioutil.NopCloser(bytes.NewReader(opts.ReqBody))
+	return r
+}
@@ -15,24 +15,35 @@ import (
 // Each request may set its own option functions that will be applied after
 // builder options and may override or add options.
 type Options struct {
-	Method  string
-	Host    string
-	Path    string
-	Params  []string
-	Query   []string
-	ReqBody []byte
-	Headers http.Header
-	Client  *http.Client
-	withs   []WithFunc
-	resBody func(*http.Response) (interface{}, interface{}, error)
-	trace   func(Options) (*httptrace.ClientTrace, error)
-	cache   Cache
+	Name        string
+	Method      string
+	Host        string
+	Path        string
+	Params      []string
+	Query       []string
+	ReqBody     []byte
+	Headers     http.Header
+	Client      *http.Client
+	withs       []WithFunc
+	middlewares []Middleware
+	afters      []AfterFunc
+	resBody     func(opts Options, response *http.Response, success bool) (interface{}, error)
+	targets     []statusTarget
+	success     func(*http.Response) bool
+	trace       func(Options) (*httptrace.ClientTrace, error)
+	cache       Cache
+	coalesce    *flights
+	hedge       *hedging
 }
 
 // Yarc Options modifier function. You should use this to
 // access and change yarc options
 type optionFunc func(opts Options) (Options, error)
 
+// OptionFunc lets code outside yarc, such as generated clients,
+// hold and pass around option functions.
+type OptionFunc = optionFunc
+
 // GET sets the request method to http.MethodGet.
 func GET() optionFunc {
 	return func(opts Options) (Options, error) {
@@ -49,6 +60,39 @@ func POST() optionFunc {
 	}
 }
 
+// PUT sets the request method to http.MethodPut.
+func PUT() optionFunc {
+	return func(opts Options) (Options, error) {
+		opts.Method = http.MethodPut
+		return opts, nil
+	}
+}
+
+// PATCH sets the request method to http.MethodPatch.
+func PATCH() optionFunc {
+	return func(opts Options) (Options, error) {
+		opts.Method = http.MethodPatch
+		return opts, nil
+	}
+}
+
+// DELETE sets the request method to http.MethodDelete.
+func DELETE() optionFunc {
+	return func(opts Options) (Options, error) {
+		opts.Method = http.MethodDelete
+		return opts, nil
+	}
+}
+
+// Name labels the request so that traces and middlewares
+// can group metrics by it instead of Method+Path.
+func Name(name string) optionFunc {
+	return func(opts Options) (Options, error) {
+		opts.Name = name
+		return opts, nil
+	}
+}
+
 // Host sets the request host+port to host.
 func Host(host string) optionFunc {
 	return func(opts Options) (Options, error) {
@@ -149,6 +193,10 @@ func Body(body []byte) optionFunc {
 // ToJSON reads the response body and if OK
 // tries to json.Uunmarshall it to body.
 // If not OK tries to json.Uunmarshall it to errBody.
+// A response is OK if it's 2xx, unless you change it with
+// Expect or SuccessWhen.
+// Targets set with OnStatus or OnStatusRange take precedence
+// over both.
 // It also adds "Accept: application/json" to the request
 // headers.
 func ToJSON(body interface{}, errBody interface{}) optionFunc {
@@ -158,37 +206,118 @@ func ToJSON(body interface{}, errBody interface{}) optionFunc {
 			return opts, err
 		}
 
-		opts.resBody = func(response *http.Response) (interface{}, interface{}, error) {
+		opts.resBody = func(opts Options, response *http.Response, success bool) (interface{}, error) {
 
 			defer response.Body.Close()
 			b, err := ioutil.ReadAll(response.Body)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
 
-			var target interface{}
-			if errBody != nil && response.StatusCode >= http.StatusBadRequest {
-				target = errBody
-			} else if body != nil && response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusBadRequest {
+			target := opts.statusTarget(response.StatusCode)
+			if target == nil && success {
 				target = body
+			} else if target == nil {
+				target = errBody
 			}
 
 			if target == nil {
-				return nil, nil, nil
+				return nil, nil
 			}
 
 			err = json.Unmarshal(b, target)
 			if err != nil {
-				return nil, nil, fmt.Errorf("error unmarshalling response: %s\nresponse: %s\ntarget: %v", err.Error(), string(b), target)
+				return nil, fmt.Errorf("error unmarshalling response: %s\nresponse: %s\ntarget: %v", err.Error(), string(b), target)
 			}
 
-			return body, errBody, nil
+			return target, nil
+		}
+
+		return opts, nil
+	}
+}
+
+// Expect makes only responses with any of statuses successful,
+// instead of every 2xx. For example, Expect(200, 404) to treat a
+// missing item as an empty result or Expect(200, 304) for
+// conditional requests.
+func Expect(statuses ...int) optionFunc {
+	return SuccessWhen(func(response *http.Response) bool {
+		for _, status := range statuses {
+			if response.StatusCode == status {
+				return true
+			}
 		}
+		return false
+	})
+}
 
+// SuccessWhen makes success decide which responses are successful,
+// instead of every 2xx. Unsuccessful responses make Go fail with
+// a Yikes and ToJSON decode them to errBody.
+func SuccessWhen(success func(*http.Response) bool) optionFunc {
+	return func(opts Options) (Options, error) {
+		opts.success = success
 		return opts, nil
 	}
 }
 
+// succeeded reports whether response is successful for opts.
+func (opts Options) succeeded(response *http.Response) bool {
+	if opts.success != nil {
+		return opts.success(response)
+	}
+
+	return response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices
+}
+
+type statusTarget struct {
+	lo     int
+	hi     int
+	target interface{}
+}
+
+// OnStatus makes ToJSON decode responses with status code to target,
+// instead of body or errBody. On unsuccessful responses target ends
+// up in Yikes.Body.
+// You should call OnStatus as many times as statuses with their
+// own schema you have.
+func OnStatus(code int, target interface{}) optionFunc {
+	return OnStatusRange(code, code, target)
+}
+
+// OnStatusRange makes ToJSON decode responses with status between
+// lo and hi (both included) to target, instead of body or errBody.
+// For example OnStatusRange(500, 599, &serverError).
+// A target set with OnStatus for a specific code takes precedence,
+// otherwise the first range that matches wins.
+func OnStatusRange(lo int, hi int, target interface{}) optionFunc {
+	return func(opts Options) (Options, error) {
+		q := len(opts.targets)
+		targets := make([]statusTarget, q, q+1)
+		for i, t := range opts.targets {
+			targets[i] = t
+		}
+		targets = append(targets, statusTarget{lo: lo, hi: hi, target: target})
+		opts.targets = targets
+		return opts, nil
+	}
+}
+
+// statusTarget returns the target set for code, if any.
+func (opts Options) statusTarget(code int) interface{} {
+	var target interface{}
+	for _, t := range opts.targets {
+		if t.lo == code && t.hi == code {
+			return t.target
+		}
+		if target == nil && t.lo <= code && code <= t.hi {
+			target = t.target
+		}
+	}
+	return target
+}
+
 // Client lets you use a custom http.Client.
 // By default yarc will use the default http.Client.
 func Client(client *http.Client) optionFunc {
@@ -217,7 +346,28 @@ func WithCache(c Cache) optionFunc {
 	}
 }
 
-//With adds with to the request's with functions.
+// NoCache makes yarc skip the cache for this request.
+func NoCache() optionFunc {
+	return WithCache(nopCache{})
+}
+
+// Coalesce deduplicates concurrent identical GET and HEAD requests.
+// Only one of them goes through the cache and to the network and every
+// caller gets its own copy of the response. Requests are identical if
+// they share method, URL and headers, so requests with different
+// credentials aren't coalesced.
+// The shared request isn't cancelled by any single caller, each of them
+// stops waiting for it when its own context is done.
+// You should use it in New so that every request shares the same
+// in-flight registry.
+func Coalesce() optionFunc {
+	return func(opts Options) (Options, error) {
+		opts.coalesce = newFlights()
+		return opts, nil
+	}
+}
+
+// With adds with to the request's with functions.
 func With(with WithFunc) optionFunc {
 	return func(opts Options) (Options, error) {
 		q := len(opts.withs)
@@ -231,6 +381,55 @@ func With(with WithFunc) optionFunc {
 	}
 }
 
+// Use adds middlewares around the request round trip (cache lookup
+// and Client.Do). They run after with functions, in the same order Use
+// was called, so the first one is the outermost.
+// You should use this for auth refresh, logging, metrics, retries or mocks.
+func Use(middlewares ...Middleware) optionFunc {
+	return func(opts Options) (Options, error) {
+		q := len(opts.middlewares)
+		mws := make([]Middleware, q, q+len(middlewares))
+		for i, mw := range opts.middlewares {
+			mws[i] = mw
+		}
+		mws = append(mws, middlewares...)
+		opts.middlewares = mws
+		return opts, nil
+	}
+}
+
+// RoundTripFunc sends the request and returns its response.
+// It must return either a response or an error.
+type RoundTripFunc func(opts Options, req *http.Request) (*http.Response, error)
+
+// Middleware wraps next so it can change the request, the response,
+// retry or even skip next altogether.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// After adds after to the functions run once the response arrives
+// (from upstream or the cache) and before it's decoded or checked for
+// a 2xx status. They run in order and see the request error, if any.
+// If any of them returns an error, Go fails with it.
+// You should use this for header driven behaviour such as capturing
+// correlation IDs or rejecting responses that violate a contract.
+func After(after AfterFunc) optionFunc {
+	return func(opts Options) (Options, error) {
+		q := len(opts.afters)
+		afters := make([]AfterFunc, q, q+1)
+		for i, a := range opts.afters {
+			afters[i] = a
+		}
+		afters = append(afters, after)
+		opts.afters = afters
+		return opts, nil
+	}
+}
+
+// Provides access to the request and its response.
+// response is nil if err is not, except when the Cache fails to store
+// it: then both are set.
+type AfterFunc func(opts Options, req *http.Request, response *http.Response, err error) error
+
 // Provides complete access to the request.
 // You can modify or even return a new request.
 type WithFunc func(opts Options, req *http.Request) *http.Request
@@ -0,0 +1,153 @@
+package yarc
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Pager returns the option functions for page number n (starting at 0),
+// given the previous page and its response. Both are zero valued for the
+// first page. It returns false once there are no more pages.
+type Pager[T any] func(n int, prev T, response *http.Response) ([]OptionFunc, bool)
+
+// Paginate makes a request with y and optsFunc for every page pager asks for,
+// yielding each one decoded to T like Do does. Unsuccessful responses are
+// decoded to E and yielded as a *TypedYikes[E].
+// It stops after the first error, when ctx is done, when pager runs out
+// of pages or after maxPages pages (0 means no limit).
+//
+//	pages := yarc.Paginate[[]Item, ApiError](ctx, client, yarc.LinkNext[[]Item](), 10, GET(), Path("/items"))
+//	for items, err := range pages {
+//		...
+//	}
+func Paginate[T, E any](ctx context.Context, y *Yarc, pager Pager[T], maxPages int, optsFunc ...optionFunc) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var prev T
+		var response *http.Response
+
+		for n := 0; maxPages <= 0 || n < maxPages; n++ {
+			page, ok := pager(n, prev, response)
+			if !ok {
+				return
+			}
+
+			if err := ctx.Err(); err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			opts := make([]optionFunc, len(optsFunc), len(optsFunc)+len(page)+1)
+			copy(opts, optsFunc)
+			opts = append(opts, page...)
+			opts = append(opts, With(Context(ctx)))
+
+			body, r, err := Do[T, E](y, opts...)
+			if !yield(body, err) || err != nil {
+				return
+			}
+
+			prev, response = body, r
+		}
+	}
+}
+
+// LinkNext follows RFC 5988 Link headers, requesting the rel="next" URL
+// until a response doesn't have one.
+func LinkNext[T any]() Pager[T] {
+	return func(n int, prev T, response *http.Response) ([]OptionFunc, bool) {
+		if n == 0 {
+			return nil, true
+		}
+
+		next := linkNext(response.Header.Values("Link"))
+		if next == "" {
+			return nil, false
+		}
+
+		if response.Request != nil {
+			if u, err := response.Request.URL.Parse(next); err == nil {
+				next = u.String()
+			}
+		}
+
+		return []OptionFunc{rawURL(next)}, true
+	}
+}
+
+// Cursor sends the cursor found in the previous page as the param query
+// param, until cursor returns an empty one.
+// For example Cursor("after", func(p Page) string { return p.Next }).
+func Cursor[T any](param string, cursor func(page T) string) Pager[T] {
+	return func(n int, prev T, response *http.Response) ([]OptionFunc, bool) {
+		if n == 0 {
+			return nil, true
+		}
+
+		next := cursor(prev)
+		if next == "" {
+			return nil, false
+		}
+
+		return []OptionFunc{Query(param, next)}, true
+	}
+}
+
+// Offset sends offsetParam and limitParam query params, moving limit items
+// forward every page, until a page has less than limit items as told by count.
+// For example Offset("offset", "limit", 50, func(items []Item) int { return len(items) }).
+func Offset[T any](offsetParam string, limitParam string, limit int, count func(page T) int) Pager[T] {
+	return func(n int, prev T, response *http.Response) ([]OptionFunc, bool) {
+		if n > 0 && count(prev) < limit {
+			return nil, false
+		}
+
+		return []OptionFunc{
+			Query(offsetParam, strconv.Itoa(n*limit)),
+			Query(limitParam, strconv.Itoa(limit)),
+		}, true
+	}
+}
+
+// rawURL makes the request go to u as is, dropping host, path,
+// params and query set so far.
+func rawURL(u string) optionFunc {
+	return func(opts Options) (Options, error) {
+		opts.Host = ""
+		opts.Path = u
+		opts.Params = nil
+		opts.Query = nil
+		return opts, nil
+	}
+}
+
+// linkNext returns the rel="next" target among links, if any.
+// Each link looks like `<https://api/items?page=2>; rel="next"`.
+func linkNext(links []string) string {
+	for _, header := range links {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(strings.TrimSpace(key), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+
+	return ""
+}
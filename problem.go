@@ -0,0 +1,78 @@
+package yarc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+// Problem is an RFC 7807 problem details object.
+// Members other than the standard ones end up in Extensions.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+func (p *Problem) UnmarshalJSON(b []byte) error {
+	members := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+
+	standard := map[string]interface{}{
+		"type":     &p.Type,
+		"title":    &p.Title,
+		"status":   &p.Status,
+		"detail":   &p.Detail,
+		"instance": &p.Instance,
+	}
+
+	for name, raw := range members {
+		if target, ok := standard[name]; ok {
+			if err := json.Unmarshal(raw, target); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if p.Extensions == nil {
+			p.Extensions = make(map[string]interface{})
+		}
+		p.Extensions[name] = value
+	}
+
+	return nil
+}
+
+// problem decodes response's body if it is an application/problem+json.
+// The body is left readable for any other decoder.
+func problem(response *http.Response) *Problem {
+	mediaType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/problem+json" {
+		return nil
+	}
+
+	b, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return nil
+	}
+
+	p := &Problem{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil
+	}
+
+	return p
+}
@@ -0,0 +1,192 @@
+package yarc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signer signs req, whose body is body, adding its signature headers.
+type Signer interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+// Sign signs every request with signer right before it's sent, after with
+// functions and the middlewares added before Sign have run.
+// You should add it after any other option or middleware that changes the
+// request, otherwise the signature won't match.
+// Requests that can't be signed fail with KindAuth.
+func Sign(signer Signer) optionFunc {
+	return Use(func(next RoundTripFunc) RoundTripFunc {
+		return func(opts Options, req *http.Request) (*http.Response, error) {
+			r := req.Clone(req.Context())
+			r.Host = host(r)
+			r.Body = ioutil.NopCloser(bytes.NewReader(opts.ReqBody))
+
+			if err := signer.Sign(r, opts.ReqBody); err != nil {
+				return nil, authError{fmt.Errorf("error signing request: %w", err)}
+			}
+
+			return next(opts, r)
+		}
+	})
+}
+
+// HMAC signs requests with HMAC-SHA256 over a canonical request:
+//
+//	X-Date: 2015-08-30T12:36:00Z
+//	X-Content-SHA256: <hex sha256 of the body>
+//	Authorization: HMAC-SHA256 KeyId=<KeyID>, SignedHeaders=host;x-content-sha256;x-date, Signature=<hex>
+//
+// The signature is the hex HMAC-SHA256, keyed with Secret, of X-Date's value,
+// a new line and the canonical request (see SigV4), signing host, x-date,
+// x-content-sha256 and Headers.
+type HMAC struct {
+	KeyID   string
+	Secret  []byte
+	Headers []string
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Sign implements Signer.
+func (h HMAC) Sign(req *http.Request, body []byte) error {
+	now := time.Now
+	if h.Now != nil {
+		now = h.Now
+	}
+
+	hash := sha256.Sum256(body)
+	req.Header.Set("X-Date", now().UTC().Format(time.RFC3339))
+	req.Header.Set("X-Content-SHA256", hex.EncodeToString(hash[:]))
+
+	names := append([]string{"host", "x-date", "x-content-sha256"}, h.Headers...)
+	canonical, signed := canonicalRequest(req, body, names, false)
+
+	signature := hmacSHA256(h.Secret, req.Header.Get("X-Date")+"\n"+canonical)
+
+	req.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 KeyId=%s, SignedHeaders=%s, Signature=%s", h.KeyID, signed, hex.EncodeToString(signature)))
+	return nil
+}
+
+// canonicalRequest returns req's canonical form and the list of signed
+// headers, as defined by AWS SigV4:
+//
+//	METHOD
+//	/uri/encoded/path
+//	sorted=encoded&query=params
+//	lowercase-name:trimmed value (one per signed header, sorted)
+//
+//	signed;header;names
+//	hex sha256 of body
+//
+// Signed headers are host and every header in names the request has.
+// Path segments are encoded twice if double is set.
+func canonicalRequest(req *http.Request, body []byte, names []string, double bool) (string, string) {
+	headers := map[string]string{"host": host(req)}
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if values, ok := req.Header[http.CanonicalHeaderKey(name)]; ok {
+			trimmed := make([]string, len(values))
+			for i, v := range values {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			headers[name] = strings.Join(trimmed, ",")
+		}
+	}
+
+	signed := make([]string, 0, len(headers))
+	for name := range headers {
+		signed = append(signed, name)
+	}
+	sort.Strings(signed)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	hash := sha256.Sum256(body)
+	return strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL, double),
+		canonicalQuery(req.URL),
+		canonicalHeaders.String(),
+		strings.Join(signed, ";"),
+		hex.EncodeToString(hash[:]),
+	}, "\n"), strings.Join(signed, ";")
+}
+
+func canonicalPath(u *url.URL, double bool) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+		if double {
+			segments[i] = uriEncode(segments[i])
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(u *url.URL) string {
+	var params [][2]string
+	for key, values := range u.Query() {
+		for _, value := range values {
+			params = append(params, [2]string{uriEncode(key), uriEncode(value)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+
+	encoded := make([]string, len(params))
+	for i, param := range params {
+		encoded[i] = param[0] + "=" + param[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+// uriEncode percent encodes everything but RFC 3986 unreserved characters.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// host returns the host req is sent to. Yarc sets req.Host to the Host
+// option, which may have a scheme, so that's left for the URL's.
+func host(req *http.Request) string {
+	if req.Host != "" && !strings.Contains(req.Host, "/") {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
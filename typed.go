@@ -0,0 +1,51 @@
+package yarc
+
+import (
+	"errors"
+	"net/http"
+)
+
+// TypedYikes is a Yikes whose error body is statically typed.
+// Body is set when the response was decoded to E.
+type TypedYikes[E any] struct {
+	*Yikes
+	Body E
+}
+
+// Unwrap returns the underlying Yikes so errors.As and errors.Is
+// keep working through it.
+func (ye *TypedYikes[E]) Unwrap() error {
+	return ye.Yikes
+}
+
+// Do makes a request with y like Go does, decoding a successful JSON
+// response to T and an unsuccessful one to E.
+// When the request fails the error is always a *TypedYikes[E], even for
+// option or URL errors. Its Body is only set if the response was decoded to E.
+//
+//	item, _, err := yarc.Do[Item, ApiError](client, GET(), Path("/items/%s"), Params("123"))
+func Do[T, E any](y *Yarc, optsFunc ...optionFunc) (T, *http.Response, error) {
+	var body T
+	var errBody E
+
+	opts := make([]optionFunc, len(optsFunc), len(optsFunc)+1)
+	copy(opts, optsFunc)
+	opts = append(opts, ToJSON(&body, &errBody))
+
+	response, err := y.Go(opts...)
+	if err == nil {
+		return body, response, nil
+	}
+
+	var ye *Yikes
+	if !errors.As(err, &ye) {
+		return body, response, err
+	}
+
+	typed := &TypedYikes[E]{Yikes: ye}
+	if target, ok := ye.Body.(*E); ok && target == &errBody {
+		typed.Body = errBody
+	}
+
+	return body, response, typed
+}
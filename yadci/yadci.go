@@ -0,0 +1,249 @@
+package yadci
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tinchogob/yarc"
+)
+
+const ext = ".yadci"
+
+// tmpPrefix prefixes files being written. Those older than tmpGrace were
+// left by a crash and are removed by New.
+const tmpPrefix = ".tmp-"
+const tmpGrace = time.Minute
+
+type disk struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+	bytes    int64
+	lock     *sync.Mutex
+}
+
+// Yet Another Disk Cache Implementation.
+// It stores responses in dir for ttl, so they survive process restarts.
+// When the stored files go over maxBytes the least recently used are
+// removed. A maxBytes of 0 means no bound.
+func New(dir string, ttl time.Duration, maxBytes int64) (*disk, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	d := &disk{
+		dir:      dir,
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		lock:     new(sync.Mutex),
+	}
+
+	all, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range all {
+		if strings.HasPrefix(f.Name(), tmpPrefix) && time.Since(f.ModTime()) > tmpGrace {
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+
+	files, err := d.files()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		d.bytes += f.Size()
+	}
+
+	return d, nil
+}
+
+func (d *disk) Get(key *http.Request) (*http.Response, error) {
+	path := d.path(key)
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// corrupted files are removed and count as a miss
+	stored, expiration, dump, err := decode(b)
+	if err != nil {
+		d.lock.Lock()
+		d.remove(path)
+		d.lock.Unlock()
+		return nil, nil
+	}
+
+	if expiration.Before(time.Now()) {
+		d.lock.Lock()
+		d.remove(path)
+		d.lock.Unlock()
+		return nil, nil
+	}
+
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(dump)), key)
+	if err != nil {
+		d.lock.Lock()
+		d.remove(path)
+		d.lock.Unlock()
+		return nil, nil
+	}
+
+	// the file modification time tracks its last use for eviction
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	age, _ := strconv.ParseInt(response.Header.Get("Age"), 10, 64)
+	age += int64(now.Sub(stored) / time.Second)
+	response.Header.Set("Age", strconv.FormatInt(age, 10))
+	response.Header.Set(yarc.HitHeader, "hit")
+
+	return response, nil
+}
+
+func (d *disk) Set(key *http.Request, response *http.Response) error {
+
+	// only successful responses are stored
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return nil
+	}
+
+	dump, err := httputil.DumpResponse(response, true)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	b := append([]byte(fmt.Sprintf("%d %d\n", now.UnixNano(), now.Add(d.ttl).UnixNano())), dump...)
+
+	if d.maxBytes > 0 && int64(len(b)) > d.maxBytes {
+		return nil
+	}
+
+	// write to a temp file and rename it so readers never see half a response
+	tmp, err := ioutil.TempFile(d.dir, tmpPrefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	path := d.path(key)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if info, err := os.Stat(path); err == nil {
+		d.bytes -= info.Size()
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	d.bytes += int64(len(b))
+
+	return d.evict()
+}
+
+// evict removes the least recently used files until
+// they fit in maxBytes. Callers must hold the lock.
+func (d *disk) evict() error {
+	if d.maxBytes <= 0 || d.bytes <= d.maxBytes {
+		return nil
+	}
+
+	files, err := d.files()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	for _, f := range files {
+		if d.bytes <= d.maxBytes {
+			break
+		}
+		d.remove(filepath.Join(d.dir, f.Name()))
+	}
+
+	return nil
+}
+
+// remove deletes path and discounts its size. Callers must hold the lock.
+func (d *disk) remove(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	if os.Remove(path) == nil {
+		d.bytes -= info.Size()
+	}
+}
+
+func (d *disk) files() ([]os.FileInfo, error) {
+	all, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := all[:0]
+	for _, f := range all {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ext) {
+			files = append(files, f)
+		}
+	}
+
+	return files, nil
+}
+
+func (d *disk) path(key *http.Request) string {
+	sum := sha256.Sum256([]byte(key.URL.String()))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+ext)
+}
+
+// decode splits a stored file in its ttl metadata and the response dump.
+func decode(b []byte) (time.Time, time.Time, []byte, error) {
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("yadci: corrupted entry")
+	}
+
+	var stored, expiration int64
+	_, err := fmt.Sscanf(string(b[:i]), "%d %d", &stored, &expiration)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("yadci: corrupted entry: %s", err.Error())
+	}
+
+	return time.Unix(0, stored), time.Unix(0, expiration), b[i+1:], nil
+}
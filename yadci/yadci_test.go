@@ -0,0 +1,175 @@
+package yadci
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tinchogob/yarc"
+)
+
+func request(url string) *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, url, nil)
+	return r
+}
+
+func response(body string) *http.Response {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		ContentLength: int64(len(body)),
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+	}
+}
+
+func TestYadci_Restart(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := New(dir, time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := response("{\"id\":\"123\"}")
+	if err := cache.Set(request("http://yarc/items/123"), res); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "{\"id\":\"123\"}" {
+		t.Errorf("expected Set to leave the body readable but got (%s)", string(body))
+	}
+
+	cache, err = New(dir, time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hit, err := cache.Get(request("http://yarc/items/123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hit == nil {
+		t.Fatal("expected a hit after restart")
+	}
+
+	body, _ = ioutil.ReadAll(hit.Body)
+	if hit.StatusCode != http.StatusOK || string(body) != "{\"id\":\"123\"}" {
+		t.Errorf("expected (200 {\"id\":\"123\"}) but got (%d %s)", hit.StatusCode, string(body))
+	}
+
+	if hit.Header.Get("Content-Type") != "application/json" || hit.Header.Get("Age") == "" || hit.Header.Get(yarc.HitHeader) != "hit" {
+		t.Errorf("expected stored headers, Age and a hit marker but got %v", hit.Header)
+	}
+}
+
+func TestYadci_Expiration(t *testing.T) {
+	cache, err := New(t.TempDir(), time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Set(request("http://yarc/items/123"), response("{}"))
+	time.Sleep(time.Millisecond * 5)
+
+	if hit, _ := cache.Get(request("http://yarc/items/123")); hit != nil {
+		t.Error("expected expired entry to miss")
+	}
+
+	if cache.bytes != 0 {
+		t.Errorf("expected expired entry to be removed but got %d bytes", cache.bytes)
+	}
+}
+
+func TestYadci_Eviction(t *testing.T) {
+	cache, err := New(t.TempDir(), time.Minute, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{"http://yarc/a", "http://yarc/b", "http://yarc/c"} {
+		if err := cache.Set(request(url), response("0123456789012345678901234567890123456789")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if hit, _ := cache.Get(request("http://yarc/a")); hit != nil {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+
+	if hit, _ := cache.Get(request("http://yarc/c")); hit == nil {
+		t.Error("expected the most recently used entry to be kept")
+	}
+
+	if cache.bytes > 300 {
+		t.Errorf("expected at most 300 bytes but got %d", cache.bytes)
+	}
+}
+
+func TestYadci_Corrupted(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := New(dir, time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := cache.path(request("http://yarc/items/123"))
+	if err := ioutil.WriteFile(path, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hit, err := cache.Get(request("http://yarc/items/123"))
+	if hit != nil || err != nil {
+		t.Errorf("expected a miss but got (%v %v)", hit, err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the corrupted entry to be removed but got (%v)", err)
+	}
+
+	if err := cache.Set(request("http://yarc/items/123"), response("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	if hit, _ := cache.Get(request("http://yarc/items/123")); hit == nil {
+		t.Errorf("expected the entry to be stored again")
+	}
+}
+
+func TestYadci_LeftoverTmp(t *testing.T) {
+	dir := t.TempDir()
+
+	old := filepath.Join(dir, tmpPrefix+"old")
+	recent := filepath.Join(dir, tmpPrefix+"recent")
+	for _, path := range []string{old, recent} {
+		if err := ioutil.WriteFile(path, []byte("half a response"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hourAgo := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(old, hourAgo, hourAgo); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(dir, time.Minute, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("expected the leftover tmp file to be removed but got (%v)", err)
+	}
+
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("expected a tmp file that may still be written to be kept but got (%v)", err)
+	}
+}
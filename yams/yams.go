@@ -167,12 +167,12 @@ func (m Mock) match(req *http.Request) error {
 }
 
 func (m Mock) write(response http.ResponseWriter) error {
-	response.WriteHeader(m.RespStatus)
 	for k, v := range m.RespHeaders {
 		for _, vv := range v {
 			response.Header().Add(k, vv)
 		}
 	}
+	response.WriteHeader(m.RespStatus)
 	response.Write(m.RespBody)
 	return nil
 }
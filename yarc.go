@@ -2,10 +2,15 @@ package yarc
 
 import (
 	"bytes"
-	"fmt"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptrace"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 //Yarc is an HTTP request builder and sender
@@ -22,6 +27,10 @@ type Cache interface {
 	Set(key *http.Request, response *http.Response) error
 }
 
+// HitHeader is set to "hit" on every response served by yasci, yadci
+// or yatci, so you can tell cached responses apart.
+const HitHeader = "X-Yarc-Cache"
+
 type nopCache struct{}
 
 func (n nopCache) Get(key *http.Request) (*http.Response, error) {
@@ -32,15 +41,28 @@ func (n nopCache) Set(key *http.Request, response *http.Response) error {
 	return nil
 }
 
-// Yikes is yarc's error implementation. Since every non 2xx response is considered an error
-// yikes carries the response body if available.
-type Yikes struct {
-	e    error
-	Body interface{}
+// Revalidator is an optional interface a Cache may implement to keep expired
+// entries around so they can be revalidated upstream instead of re-downloaded.
+// When Get misses, Go asks for a Stale response and, if it carries an ETag or
+// a Last-Modified header, sends a conditional request with If-None-Match and
+// If-Modified-Since. On a 304 Revalidated is called instead of Set and must
+// refresh the stored entry and return the cached response, or nil if the
+// entry is gone so that Go sends the request again without validators.
+type Revalidator interface {
+	Stale(key *http.Request) (*http.Response, error)
+	Revalidated(key *http.Request, response *http.Response) (*http.Response, error)
 }
 
-func (ye Yikes) Error() string {
-	return ye.e.Error()
+// StaleServer is an optional interface a Revalidator may implement to answer
+// with a Stale response instead of waiting for (or failing with) upstream.
+// ServeStale reports whether stale may be returned right away while Go
+// refreshes it in background. It should return true once per key until the
+// entry is Set or Revalidated so that only one refresh runs at a time.
+// ServeStaleOnError reports whether stale may be returned instead of a
+// transport error or a 5xx response.
+type StaleServer interface {
+	ServeStale(key *http.Request, stale *http.Response) bool
+	ServeStaleOnError(key *http.Request, stale *http.Response) bool
 }
 
 // New returns a Yarc builder. Option functions passed here will be applied to
@@ -56,7 +78,7 @@ func New(optsFunc ...optionFunc) (*Yarc, error) {
 	for _, optFunc := range optsFunc {
 		opts, err = optFunc(opts)
 		if err != nil {
-			return nil, &Yikes{e: err}
+			return nil, &Yikes{Kind: KindOption, Cause: err}
 		}
 	}
 
@@ -74,14 +96,22 @@ func (y *Yarc) Go(optsFunc ...optionFunc) (*http.Response, error) {
 	for _, optFunc := range optsFunc {
 		opts, err = optFunc(opts)
 		if err != nil {
-			return nil, &Yikes{e: err}
+			return nil, &Yikes{Kind: KindOption, Method: opts.Method, Cause: err}
 		}
 	}
 
 	url := getURL(opts)
 	req, err := http.NewRequest(opts.Method, url, bytes.NewBuffer(opts.ReqBody))
 	if err != nil {
-		return nil, &Yikes{e: err}
+		return nil, &Yikes{Kind: KindURL, Method: opts.Method, URL: url, Cause: err}
+	}
+
+	yikes := func(kind Kind, response *http.Response, attempts int32, cause error) *Yikes {
+		ye := &Yikes{Kind: kind, Method: req.Method, URL: url, Attempts: int(attempts), Cause: cause}
+		if response != nil {
+			ye.StatusCode = response.StatusCode
+		}
+		return ye
 	}
 
 	req.Host = opts.Host
@@ -94,46 +124,208 @@ func (y *Yarc) Go(optsFunc ...optionFunc) (*http.Response, error) {
 	if opts.trace != nil {
 		t, err := opts.trace(opts)
 		if err != nil {
-			return nil, &Yikes{e: err}
+			return nil, yikes(KindOption, nil, 0, err)
 		}
 		req = req.WithContext(httptrace.WithClientTrace(req.Context(), t))
 	}
 
-	var response *http.Response
-	response, err = opts.cache.Get(req)
+	// attempts counts how many times the request got to the cache
+	// or upstream, middlewares may retry it.
+	var attempts int32
+	do := RoundTripFunc(func(opts Options, req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&attempts, 1)
+		return roundTrip(opts, req)
+	})
+	if opts.hedge != nil {
+		do = opts.hedge.wrap(do)
+	}
+	for i := len(opts.middlewares) - 1; i >= 0; i-- {
+		do = opts.middlewares[i](do)
+	}
+
+	response, err := do(opts, req)
+	kind := kindOf(err)
+	for _, after := range opts.afters {
+		if afterErr := after(opts, req, response, err); afterErr != nil {
+			err = afterErr
+			kind = KindHook
+		}
+	}
+
 	if err != nil {
-		return nil, &Yikes{e: err}
+		return response, yikes(kind, response, attempts, unwrapCache(err))
 	}
 
-	if response == nil {
+	success := opts.succeeded(response)
+
+	var details *Problem
+	if !success {
+		details = problem(response)
+	}
 
-		response, err = opts.Client.Do(req)
+	var target interface{}
+	if opts.resBody != nil {
+		target, err = opts.resBody(opts, response, success)
 		if err != nil {
-			return nil, &Yikes{e: err}
+			return response, yikes(KindDecode, response, attempts, err)
 		}
+	}
 
-		err = opts.cache.Set(req, response)
-		if err != nil {
-			return response, &Yikes{e: err}
+	if !success {
+		ye := yikes(KindStatus, response, attempts, nil)
+		ye.Body = target
+		ye.Problem = details
+		return response, ye
+	}
+
+	return response, nil
+}
+
+// roundTrip is the innermost RoundTripFunc. It goes through the cache
+// and upstream, coalescing identical requests if asked to.
+// Hedged requests aren't coalesced, see hedgeKey.
+func roundTrip(opts Options, req *http.Request) (*http.Response, error) {
+	hedged := req.Context().Value(hedgeKey{}) != nil
+	if opts.coalesce != nil && !hedged && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		return opts.coalesce.do(req.Context(), flightKey(req), func(ctx context.Context) (*http.Response, error) {
+			return lookup(opts, req.WithContext(ctx))
+		})
+	}
+
+	return lookup(opts, req)
+}
+
+// lookup looks for req in the cache and goes upstream on a miss.
+func lookup(opts Options, req *http.Request) (*http.Response, error) {
+	response, err := opts.cache.Get(req)
+	if err != nil {
+		return nil, cacheError{err}
+	}
+
+	if response == nil {
+		return fromUpstream(opts, req)
+	}
+
+	return response, nil
+}
+
+// refreshTimeout bounds background refreshes of stale entries
+// when the Client has no Timeout of its own.
+var refreshTimeout = 30 * time.Second
+
+// fromUpstream makes the request on a cache miss and stores its response.
+// If the cache keeps expired entries it may revalidate them, serve them
+// while they're refreshed in background or serve them when upstream fails.
+func fromUpstream(opts Options, req *http.Request) (*http.Response, error) {
+	rv, ok := opts.cache.(Revalidator)
+	if !ok {
+		return doAndSet(opts, req, nil)
+	}
+
+	stale, err := rv.Stale(req)
+	if err != nil {
+		return nil, cacheError{err}
+	}
+
+	if stale == nil {
+		return doAndSet(opts, req, nil)
+	}
+
+	ss, serves := opts.cache.(StaleServer)
+	if serves && ss.ServeStale(req, stale) {
+		timeout := refreshTimeout
+		if opts.Client.Timeout > 0 {
+			timeout = opts.Client.Timeout
 		}
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), timeout)
+		bg := conditional(req.Clone(ctx), stale)
+		bg.Body = ioutil.NopCloser(bytes.NewBuffer(opts.ReqBody))
+		go func() {
+			defer cancel()
+			// nobody is waiting for this one, errors are left for
+			// the cache to retry on a later request.
+			response, _ := doAndSet(opts, bg, rv)
+			if response != nil {
+				io.Copy(ioutil.Discard, response.Body)
+				response.Body.Close()
+			}
+		}()
+		return stale, nil
+	}
 
+	response, err := doAndSet(opts, conditional(req, stale), rv)
+	var ce cacheError
+	failed := (err != nil && !errors.As(err, &ce)) || (response != nil && response.StatusCode >= http.StatusInternalServerError)
+	if serves && failed && ss.ServeStaleOnError(req, stale) {
+		if response != nil {
+			response.Body.Close()
+		}
+		return stale, nil
 	}
 
-	var errorBody interface{}
-	if opts.resBody != nil {
-		_, errorBody, err = opts.resBody(response)
+	stale.Body.Close()
+	return response, err
+}
+
+// doAndSet sends req and stores the response in the cache.
+// If rv is not nil req was made conditional, so a 304 refreshes
+// the cached entry instead.
+func doAndSet(opts Options, req *http.Request, rv Revalidator) (*http.Response, error) {
+	response, err := send(opts, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rv != nil && response.StatusCode == http.StatusNotModified {
+		revalidated, err := rv.Revalidated(req, response)
 		if err != nil {
-			return response, &Yikes{e: fmt.Errorf("error %d %s %s %s", response.StatusCode, opts.Method, url, err.Error())}
+			return nil, cacheError{err}
 		}
+		if revalidated == nil {
+			return doAndSet(opts, unconditional(opts, req), nil)
+		}
+		return revalidated, nil
 	}
 
-	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
-		return response, &Yikes{e: fmt.Errorf("error %d %s %s", response.StatusCode, opts.Method, url), Body: errorBody}
+	err = opts.cache.Set(req, response)
+	if err != nil {
+		return response, cacheError{err}
 	}
 
 	return response, nil
 }
 
+// conditional adds stale's validators to req so upstream can answer
+// with a 304 if the cached entry is still good.
+// req headers are shared with Yarc options so they get copied first.
+func conditional(req *http.Request, stale *http.Response) *http.Request {
+	etag := stale.Header.Get("ETag")
+	lastModified := stale.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return req
+	}
+
+	req.Header = req.Header.Clone()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	return req
+}
+
+// unconditional returns a copy of req without the validators
+// conditional added, for when the cached entry is gone.
+func unconditional(opts Options, req *http.Request) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Del("If-None-Match")
+	r.Header.Del("If-Modified-Since")
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(opts.ReqBody))
+	return r
+}
+
 func getURL(opts Options) string {
 	url := opts.Path
 	for _, param := range opts.Params {
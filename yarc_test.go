@@ -1,8 +1,25 @@
 package yarc
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/tinchogob/yarc/yams"
 )
@@ -138,3 +155,1232 @@ func TestGo_AdvancedFail(t *testing.T) {
 		t.Errorf("expected a server error")
 	}
 }
+
+// recordingCache never hits and records the urls it's asked to store,
+// failing with err if set.
+type recordingCache struct {
+	urls []string
+	err  error
+}
+
+func (c *recordingCache) Get(key *http.Request) (*http.Response, error) {
+	return nil, nil
+}
+
+func (c *recordingCache) Set(key *http.Request, response *http.Response) error {
+	c.urls = append(c.urls, key.URL.String())
+	return c.err
+}
+
+// evictedCache always has a stale entry which is gone by the time
+// it's revalidated.
+type evictedCache struct {
+	sets int
+}
+
+func (c *evictedCache) Get(key *http.Request) (*http.Response, error) {
+	return nil, nil
+}
+
+func (c *evictedCache) Set(key *http.Request, response *http.Response) error {
+	c.sets++
+	return nil
+}
+
+func (c *evictedCache) Stale(key *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Etag": {"\"v1\""}},
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+	}, nil
+}
+
+func (c *evictedCache) Revalidated(key *http.Request, response *http.Response) (*http.Response, error) {
+	response.Body.Close()
+	return nil, nil
+}
+
+func TestGo_RevalidateEvicted(t *testing.T) {
+
+	var validators []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		validators = append(validators, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("{\"id\":\"123\"}"))
+	}))
+	defer server.Close()
+
+	cache := &evictedCache{}
+	client, err := New(Host(server.URL), Path("/items/123"), WithCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := struct {
+		ID string `json:"id"`
+	}{}
+
+	response, err := client.Go(GET(), ToJSON(&item, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.StatusCode != http.StatusOK || item.ID != "123" || cache.sets != 1 {
+		t.Errorf("expected (200 123 1) but got (%d %s %d)", response.StatusCode, item.ID, cache.sets)
+	}
+
+	if strings.Join(validators, ",") != "\"v1\"," {
+		t.Errorf("expected a conditional and then a plain request but got (%v)", validators)
+	}
+}
+
+func TestGo_Middlewares(t *testing.T) {
+
+	server, err := yams.New(8181)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.Add(yams.Mock{
+		Method:     http.MethodGet,
+		URL:        "/ping",
+		RespStatus: http.StatusOK,
+		RespBody:   []byte("{\"id\":\"pong\"}"),
+	})
+
+	var calls []string
+	logger := func(name string) Middleware {
+		return func(next RoundTripFunc) RoundTripFunc {
+			return func(opts Options, req *http.Request) (*http.Response, error) {
+				calls = append(calls, name+" "+opts.Path)
+				response, err := next(opts, req)
+				if response != nil {
+					response.Header.Set("X-"+name, "seen")
+				}
+				return response, err
+			}
+		}
+	}
+
+	mock := func(next RoundTripFunc) RoundTripFunc {
+		return func(opts Options, req *http.Request) (*http.Response, error) {
+			if opts.Path != "/mocked" {
+				return next(opts, req)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader("{\"id\":\"mocked\"}")),
+			}, nil
+		}
+	}
+
+	client, err := New(
+		Host("http://localhost:8181"),
+		Use(logger("Outer")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, id := range map[string]string{"/ping": "pong", "/mocked": "mocked"} {
+		item := struct {
+			ID string `json:"id"`
+		}{}
+
+		response, err := client.Go(GET(), Path(path), Use(logger("Inner"), mock), ToJSON(&item, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response.Header.Get("X-Outer") != "seen" || response.Header.Get("X-Inner") != "seen" {
+			t.Errorf("%s: expected both middlewares to see the response but got %v", path, response.Header)
+		}
+
+		if item.ID != id {
+			t.Errorf("%s: expected (%s) but got (%s)", path, id, item.ID)
+		}
+	}
+
+	sort.Strings(calls)
+	expected := []string{"Inner /mocked", "Inner /ping", "Outer /mocked", "Outer /ping"}
+	if strings.Join(calls, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected (%v) but got (%v)", expected, calls)
+	}
+}
+
+func TestGo_After(t *testing.T) {
+
+	server, err := yams.New(8181)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.Add(yams.Mock{
+		Method:      http.MethodGet,
+		URL:         "/ping",
+		RespStatus:  http.StatusOK,
+		RespHeaders: http.Header{"X-Request-Id": {"abc"}},
+		RespBody:    []byte("{\"id\":\"pong\"}"),
+		Times:       2,
+	})
+
+	var requestID string
+	capture := func(opts Options, req *http.Request, response *http.Response, err error) error {
+		if err == nil {
+			requestID = response.Header.Get("X-Request-Id")
+		}
+		return nil
+	}
+
+	contract := func(opts Options, req *http.Request, response *http.Response, err error) error {
+		if err == nil && response.Header.Get("Content-Type") != "application/json" {
+			return fmt.Errorf("unexpected content type (%s)", response.Header.Get("Content-Type"))
+		}
+		return nil
+	}
+
+	client, err := New(Host("http://localhost:8181"), Path("/ping"), After(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := struct {
+		ID string `json:"id"`
+	}{}
+
+	_, err = client.Go(GET(), ToJSON(&item, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requestID != "abc" || item.ID != "pong" {
+		t.Errorf("expected (abc pong) but got (%s %s)", requestID, item.ID)
+	}
+
+	item.ID = ""
+	_, err = client.Go(GET(), After(contract), ToJSON(&item, nil))
+	if err == nil || err.Error() != "unexpected content type (text/plain; charset=utf-8)" {
+		t.Errorf("expected the contract to be violated but got (%v)", err)
+	}
+
+	if item.ID != "" {
+		t.Errorf("expected rejected responses not to be decoded but got (%s)", item.ID)
+	}
+}
+
+func TestGo_Yikes(t *testing.T) {
+
+	server, err := yams.New(8181)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.Add(
+		yams.Mock{
+			Method:     http.MethodGet,
+			URL:        "/slow",
+			RespStatus: http.StatusOK,
+			Wait:       time.Millisecond * 100,
+		},
+		yams.Mock{
+			Method:     http.MethodGet,
+			URL:        "/fail",
+			RespStatus: http.StatusServiceUnavailable,
+		},
+		yams.Mock{
+			Method:     http.MethodGet,
+			URL:        "/garbage",
+			RespStatus: http.StatusOK,
+			RespBody:   []byte("not json"),
+		},
+	)
+
+	client, err := New(Host("http://localhost:8181"), Client(&http.Client{Timeout: time.Millisecond * 20}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		opts   []optionFunc
+		kind   Kind
+		status int
+	}{
+		{name: "Timeout", opts: []optionFunc{Path("/slow")}, kind: KindTimeout},
+		{name: "Status", opts: []optionFunc{Path("/fail")}, kind: KindStatus, status: http.StatusServiceUnavailable},
+		{name: "Decode", opts: []optionFunc{Path("/garbage"), ToJSON(&struct{}{}, nil)}, kind: KindDecode, status: http.StatusOK},
+		{name: "URL", opts: []optionFunc{Host("http://local host")}, kind: KindURL},
+		{name: "Transport", opts: []optionFunc{Host("http://localhost:1")}, kind: KindTransport},
+		{name: "Option", opts: []optionFunc{JSON(func() {})}, kind: KindOption},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := client.Go(append([]optionFunc{GET()}, c.opts...)...)
+
+			var ye *Yikes
+			if !errors.As(err, &ye) {
+				t.Fatalf("expected a Yikes but got (%v)", err)
+			}
+
+			if !errors.Is(err, c.kind) || ye.StatusCode != c.status {
+				t.Errorf("expected (%s %d) but got (%s %d): %s", c.kind, c.status, ye.Kind, ye.StatusCode, err.Error())
+			}
+
+			if c.kind == KindTimeout || c.kind == KindTransport {
+				if ye.Attempts != 1 || ye.Cause == nil || errors.Unwrap(err) != ye.Cause {
+					t.Errorf("expected 1 attempt and a cause but got (%d %v)", ye.Attempts, ye.Cause)
+				}
+			}
+		})
+	}
+}
+
+func TestGo_Expect(t *testing.T) {
+
+	server, err := yams.New(8181)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.Add(
+		yams.Mock{
+			Method:     http.MethodGet,
+			URL:        "/items/404",
+			RespStatus: http.StatusNotFound,
+			RespBody:   []byte("{\"id\":\"none\"}"),
+			Times:      2,
+		},
+		yams.Mock{
+			Method:     http.MethodGet,
+			URL:        "/items/200",
+			RespStatus: http.StatusOK,
+			RespBody:   []byte("{\"id\":\"200\"}"),
+		},
+	)
+
+	client, err := New(Host("http://localhost:8181"), Path("/items/%s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		param   string
+		success optionFunc
+		fails   bool
+		body    string
+		errBody string
+	}{
+		{name: "Default", param: "404", success: SuccessWhen(nil), fails: true, errBody: "none"},
+		{name: "Expect", param: "404", success: Expect(http.StatusOK, http.StatusNotFound), body: "none"},
+		{name: "SuccessWhen", param: "200", success: SuccessWhen(func(r *http.Response) bool { return r.StatusCode == http.StatusCreated }), fails: true, errBody: "200"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			body := struct {
+				ID string `json:"id"`
+			}{}
+			errBody := struct {
+				ID string `json:"id"`
+			}{}
+
+			_, err := client.Go(GET(), Params(c.param), c.success, ToJSON(&body, &errBody))
+			if (err != nil) != c.fails {
+				t.Errorf("expected failure to be %t but got (%v)", c.fails, err)
+			}
+
+			if body.ID != c.body || errBody.ID != c.errBody {
+				t.Errorf("expected (%s %s) but got (%s %s)", c.body, c.errBody, body.ID, errBody.ID)
+			}
+		})
+	}
+}
+
+func TestGo_OnStatus(t *testing.T) {
+
+	server, err := yams.New(8181)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.Add(
+		yams.Mock{
+			Method:     http.MethodPost,
+			URL:        "/items/422",
+			RespStatus: http.StatusUnprocessableEntity,
+			RespBody:   []byte("{\"fields\":[\"title\"]}"),
+		},
+		yams.Mock{
+			Method:     http.MethodPost,
+			URL:        "/items/409",
+			RespStatus: http.StatusConflict,
+			RespBody:   []byte("{\"existing\":\"123\"}"),
+		},
+		yams.Mock{
+			Method:     http.MethodPost,
+			URL:        "/items/503",
+			RespStatus: http.StatusServiceUnavailable,
+			RespBody:   []byte("{\"message\":\"try later\"}"),
+		},
+	)
+
+	type validation struct {
+		Fields []string `json:"fields"`
+	}
+	type conflict struct {
+		Existing string `json:"existing"`
+	}
+	type generic struct {
+		Message string `json:"message"`
+	}
+
+	client, err := New(Host("http://localhost:8181"), Path("/items/%s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		param    string
+		expected interface{}
+	}{
+		{param: "422", expected: &validation{Fields: []string{"title"}}},
+		{param: "409", expected: &conflict{Existing: "123"}},
+		{param: "503", expected: &generic{Message: "try later"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.param, func(t *testing.T) {
+			_, err := client.Go(
+				POST(),
+				Params(c.param),
+				OnStatusRange(500, 599, &generic{}),
+				OnStatus(http.StatusUnprocessableEntity, &validation{}),
+				OnStatus(http.StatusConflict, &conflict{}),
+				ToJSON(nil, &generic{}),
+			)
+
+			var ye *Yikes
+			if !errors.As(err, &ye) {
+				t.Fatalf("expected a Yikes but got (%v)", err)
+			}
+
+			if !reflect.DeepEqual(ye.Body, c.expected) {
+				t.Errorf("expected (%+v) but got (%+v)", c.expected, ye.Body)
+			}
+		})
+	}
+}
+
+func TestGo_Problem(t *testing.T) {
+
+	server, err := yams.New(8181)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.Add(yams.Mock{
+		Method:      http.MethodGet,
+		URL:         "/items/123",
+		RespStatus:  http.StatusForbidden,
+		RespHeaders: http.Header{"Content-Type": {"application/problem+json; charset=utf-8"}},
+		RespBody:    []byte("{\"type\":\"https://example.com/probs/out-of-credit\",\"title\":\"You do not have enough credit.\",\"status\":403,\"detail\":\"Your current balance is 30, but that costs 50.\",\"instance\":\"/items/123\",\"balance\":30}"),
+		Times:       2,
+	})
+
+	client, err := New(Host("http://localhost:8181"), Path("/items/123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Problem{
+		Type:       "https://example.com/probs/out-of-credit",
+		Title:      "You do not have enough credit.",
+		Status:     http.StatusForbidden,
+		Detail:     "Your current balance is 30, but that costs 50.",
+		Instance:   "/items/123",
+		Extensions: map[string]interface{}{"balance": float64(30)},
+	}
+
+	// with and without an errBody to decode it to
+	for _, errBody := range []*Problem{nil, {}} {
+		opts := []optionFunc{GET()}
+		if errBody != nil {
+			opts = append(opts, ToJSON(nil, errBody))
+		}
+
+		_, err := client.Go(opts...)
+
+		var ye *Yikes
+		if !errors.As(err, &ye) {
+			t.Fatalf("expected a Yikes but got (%v)", err)
+		}
+
+		if !reflect.DeepEqual(ye.Problem, expected) {
+			t.Errorf("expected (%+v) but got (%+v)", expected, ye.Problem)
+		}
+
+		if errBody != nil && !reflect.DeepEqual(errBody, expected) {
+			t.Errorf("expected errBody (%+v) but got (%+v)", expected, errBody)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+
+	server, err := yams.New(8181)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.Add(
+		yams.Mock{
+			Method:     http.MethodGet,
+			URL:        "/items/123",
+			RespStatus: http.StatusOK,
+			RespBody:   []byte("{\"id\":\"123\"}"),
+		},
+		yams.Mock{
+			Method:     http.MethodGet,
+			URL:        "/items/456",
+			RespStatus: http.StatusNotFound,
+			RespBody:   []byte("{\"message\":\"not found\"}"),
+		},
+	)
+
+	type item struct {
+		ID string `json:"id"`
+	}
+	type apiError struct {
+		Message string `json:"message"`
+	}
+
+	client, err := New(Host("http://localhost:8181"), Path("/items/%s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it, response, err := Do[item, apiError](client, GET(), Params("123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if it.ID != "123" || response.StatusCode != http.StatusOK {
+		t.Errorf("expected (123 200) but got (%s %d)", it.ID, response.StatusCode)
+	}
+
+	_, _, err = Do[item, apiError](client, GET(), Params("456"))
+
+	var typed *TypedYikes[apiError]
+	if !errors.As(err, &typed) {
+		t.Fatalf("expected a TypedYikes but got (%v)", err)
+	}
+
+	if typed.Body.Message != "not found" || !errors.Is(err, KindStatus) {
+		t.Errorf("expected (not found status) but got (%s %s)", typed.Body.Message, typed.Kind)
+	}
+
+	var ye *Yikes
+	if !errors.As(err, &ye) || ye.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the Yikes to be reachable but got (%v)", ye)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+
+	server, err := yams.New(8181)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.Add(
+		yams.Mock{
+			Method:     http.MethodGet,
+			URL:        "/items/123\\?attributes=id",
+			ReqHeaders: http.Header{"X-Client": {"yarc"}},
+			RespStatus: http.StatusOK,
+			RespBody:   []byte("{\"id\":\"123\"}"),
+		},
+		yams.Mock{
+			Method:     http.MethodPut,
+			URL:        "/items/456",
+			ReqBody:    []byte("{\"id\":\"456\"}"),
+			RespStatus: http.StatusOK,
+			RespBody:   []byte("{\"id\":\"456\"}"),
+		},
+	)
+
+	type item struct {
+		ID string `json:"id"`
+	}
+
+	var names []string
+	labels := func(next RoundTripFunc) RoundTripFunc {
+		return func(opts Options, req *http.Request) (*http.Response, error) {
+			names = append(names, opts.Name)
+			return next(opts, req)
+		}
+	}
+
+	client, err := New(Host("http://localhost:8181"), Use(labels))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getItem := NewEndpoint[NoBody, item, struct{}](client, "get_item",
+		GET(),
+		Path("/items/%s"),
+		Header("X-Client", "yarc"),
+		Query("attributes", "id"),
+	)
+
+	putItem := NewEndpoint[item, item, struct{}](client, "put_item",
+		PUT(),
+		Path("/items/%s"),
+	)
+
+	got, _, err := getItem.Call(context.Background(), NoBody{}, "123")
+	if err != nil || got.ID != "123" {
+		t.Errorf("expected (123) but got (%s %v)", got.ID, err)
+	}
+
+	got, _, err = putItem.Call(context.Background(), item{ID: "456"}, "456")
+	if err != nil || got.ID != "456" {
+		t.Errorf("expected (456) but got (%s %v)", got.ID, err)
+	}
+
+	if strings.Join(names, ",") != "get_item,put_item" {
+		t.Errorf("expected requests to be labeled but got (%v)", names)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+
+	items := []string{"a", "b", "c", "d", "e", "f"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/link":
+			page, _ := strconv.Atoi(query.Get("page"))
+			if page >= 3 {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("{\"message\":\"boom\"}"))
+				return
+			}
+			if page < 2 {
+				w.Header().Add("Link", fmt.Sprintf("</link?page=%d>; rel=\"next\", </link?page=0>; rel=\"first\"", page+1))
+			}
+			fmt.Fprintf(w, "[%q,%q]", items[page*2], items[page*2+1])
+		case "/broken":
+			w.Header().Add("Link", "</link?page=3>; rel=\"next\"")
+			w.Write([]byte("[]"))
+		case "/cursor":
+			next := map[string]string{"": "c", "c": "e"}[query.Get("after")]
+			i := strings.Index(strings.Join(items, ""), query.Get("after"))
+			if i < 0 {
+				i = 0
+			}
+			fmt.Fprintf(w, "{\"items\":[%q],\"next\":%q}", items[i], next)
+		case "/offset":
+			offset, _ := strconv.Atoi(query.Get("offset"))
+			limit, _ := strconv.Atoi(query.Get("limit"))
+			end := offset + limit
+			if end > len(items) {
+				end = len(items)
+			}
+			fmt.Fprintf(w, "[\"%s\"]", strings.Join(items[offset:end], "\",\""))
+		}
+	}))
+	defer server.Close()
+
+	type apiError struct {
+		Message string `json:"message"`
+	}
+	type page struct {
+		Items []string `json:"items"`
+		Next  string   `json:"next"`
+	}
+
+	client, err := New(Host(server.URL), GET())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collect := func(pages func(yield func([]string, error) bool)) ([]string, error) {
+		var got []string
+		for items, err := range pages {
+			if err != nil {
+				return got, err
+			}
+			got = append(got, items...)
+		}
+		return got, nil
+	}
+
+	got, err := collect(Paginate[[]string, apiError](context.Background(), client, LinkNext[[]string](), 0, Path("/link")))
+	if err != nil || strings.Join(got, "") != "abcdef" {
+		t.Errorf("expected (abcdef) but got (%v %v)", got, err)
+	}
+
+	got, err = collect(Paginate[[]string, apiError](context.Background(), client, LinkNext[[]string](), 2, Path("/link")))
+	if err != nil || strings.Join(got, "") != "abcd" {
+		t.Errorf("expected maxPages to stop at (abcd) but got (%v %v)", got, err)
+	}
+
+	_, err = collect(Paginate[[]string, apiError](context.Background(), client, LinkNext[[]string](), 0, Path("/broken")))
+	var typed *TypedYikes[apiError]
+	if !errors.As(err, &typed) || typed.Body.Message != "boom" {
+		t.Errorf("expected the failed page to stop with its error but got (%v)", err)
+	}
+
+	var cursored []string
+	cursor := Cursor("after", func(p page) string { return p.Next })
+	for p, err := range Paginate[page, apiError](context.Background(), client, cursor, 0, Path("/cursor")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursored = append(cursored, p.Items...)
+	}
+	if strings.Join(cursored, "") != "ace" {
+		t.Errorf("expected (ace) but got (%v)", cursored)
+	}
+
+	offset := Offset("offset", "limit", 2, func(items []string) int { return len(items) })
+	got, err = collect(Paginate[[]string, apiError](context.Background(), client, offset, 0, Path("/offset")))
+	if err != nil || strings.Join(got, "") != "abcdef" {
+		t.Errorf("expected (abcdef) but got (%v %v)", got, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pages := 0
+	for _, err := range Paginate[[]string, apiError](ctx, client, offset, 0, Path("/offset")) {
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("expected context.Canceled but got (%v)", err)
+			}
+			break
+		}
+		pages++
+		cancel()
+	}
+	if pages != 1 {
+		t.Errorf("expected to stop after the first page but got (%d)", pages)
+	}
+}
+
+func TestGoAll(t *testing.T) {
+
+	var running, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	client, err := New(Host(server.URL), GET())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []Call
+	for i := 0; i < 10; i++ {
+		calls = append(calls, Call{Path("/%s"), Params(fmt.Sprint(i))})
+	}
+	calls[3] = Call{Path("/fail")}
+
+	results, err := client.GoAll(context.Background(), calls, 3, CollectAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, result := range results {
+		if i == 3 {
+			if !errors.Is(result.Err, KindStatus) {
+				t.Errorf("expected call 3 to fail with a status error but got (%v)", result.Err)
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Fatalf("expected call %d to succeed but got (%v)", i, result.Err)
+		}
+		b, err := ioutil.ReadAll(result.Response.Body)
+		result.Response.Body.Close()
+		if err != nil || string(b) != fmt.Sprintf("/%d", i) {
+			t.Errorf("expected (/%d) but got (%s %v)", i, string(b), err)
+		}
+	}
+
+	if peak > 3 {
+		t.Errorf("expected at most 3 calls at a time but got (%d)", peak)
+	}
+
+	calls = []Call{{Path("/slow")}, {Path("/fail")}, {Path("/0")}, {Path("/1")}}
+	start := time.Now()
+	results, err = client.GoAll(context.Background(), calls, 2, FailFast)
+
+	if !errors.Is(err, KindStatus) || results[1].Err != err {
+		t.Errorf("expected the failed call's error but got (%v)", err)
+	}
+
+	if !errors.Is(results[0].Err, context.Canceled) || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected the running call to be cancelled but got (%v)", results[0].Err)
+	}
+
+	for _, result := range results[2:] {
+		if !errors.Is(result.Err, context.Canceled) || result.Response != nil {
+			t.Errorf("expected pending calls to be skipped but got (%v)", result.Err)
+		}
+	}
+}
+
+func TestGo_Hedge(t *testing.T) {
+
+	var requests, cancelled int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+
+		wait := 10 * time.Millisecond
+		if n == 1 || r.URL.Path == "/slow" {
+			wait = 200 * time.Millisecond
+		}
+
+		select {
+		case <-r.Context().Done():
+			atomic.AddInt32(&cancelled, 1)
+			return
+		case <-time.After(wait):
+		}
+
+		if r.URL.Path == "/slow" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "%d", n)
+	}))
+	defer server.Close()
+
+	client, err := New(Host(server.URL), Hedge(30*time.Millisecond, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	response, err := client.Go(GET(), Path("/fast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if string(b) != "2" || time.Since(start) > 150*time.Millisecond {
+		t.Errorf("expected the hedged attempt to win but got (%s) after %s", string(b), time.Since(start))
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&cancelled) != 1 {
+		t.Errorf("expected the first attempt to be cancelled but got (%d)", cancelled)
+	}
+
+	_, err = client.Go(GET(), Path("/slow"))
+	var ye *Yikes
+	if !errors.As(err, &ye) || ye.StatusCode != http.StatusServiceUnavailable || ye.Attempts != 3 {
+		t.Errorf("expected (503 after 3 attempts) but got (%v)", err)
+	}
+
+	// hedged requests don't take coalesced callers down with them.
+	atomic.StoreInt32(&requests, 0)
+	coalesced, err := New(Host(server.URL), Path("/fast"), Coalesce())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make([]error, 2)
+	wg := new(sync.WaitGroup)
+	for i, opts := range [][]optionFunc{{GET(), Hedge(30*time.Millisecond, 2)}, {GET()}} {
+		wg.Add(1)
+		go func(i int, opts []optionFunc) {
+			defer wg.Done()
+			response, err := coalesced.Go(opts...)
+			if err == nil {
+				_, err = ioutil.ReadAll(response.Body)
+				response.Body.Close()
+			}
+			errs[i] = err
+		}(i, opts)
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("expected both requests to succeed but got (%v %v)", errs[0], errs[1])
+	}
+
+	if r := atomic.LoadInt32(&requests); r != 3 {
+		t.Errorf("expected the plain request not to join a hedged attempt but got (%d) requests", r)
+	}
+
+	// an attempt that fails to be cached still wins, as it would unhedged.
+	atomic.StoreInt32(&requests, 0)
+	cached, err := New(Host(server.URL), Path("/fast"), WithCache(&recordingCache{err: errors.New("cache is full")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err = cached.Go(GET(), Hedge(30*time.Millisecond, 2))
+	if !errors.Is(err, KindCache) || response == nil {
+		t.Fatalf("expected the response next to a KindCache error but got (%v %v)", response, err)
+	}
+	if _, err := ioutil.ReadAll(response.Body); err != nil {
+		t.Errorf("expected the response body to be readable but got (%v)", err)
+	}
+	response.Body.Close()
+
+	atomic.StoreInt32(&requests, 0)
+	_, err = client.Go(POST(), Path("/fast"))
+	if err != nil || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("expected POST not to be hedged but got (%d %v)", requests, err)
+	}
+}
+
+func TestOAuth2(t *testing.T) {
+
+	server, err := yams.New(8181)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("id:secret"))
+	server.Add(
+		yams.Mock{
+			Method:      http.MethodPost,
+			URL:         "/oauth/token",
+			ReqHeaders:  http.Header{"Authorization": {basic}, "Content-Type": {"application/x-www-form-urlencoded"}},
+			ReqBody:     []byte("grant_type=client_credentials&scope=read+write"),
+			RespStatus:  http.StatusOK,
+			RespHeaders: http.Header{"Content-Type": {"application/json"}},
+			RespBody:    []byte("{\"access_token\":\"abc\",\"token_type\":\"bearer\",\"expires_in\":3600}"),
+			Times:       2,
+		},
+		yams.Mock{
+			Method:     http.MethodPost,
+			URL:        "/oauth/refresh",
+			ReqHeaders: http.Header{"Authorization": {basic}},
+			ReqBody:    []byte("grant_type=refresh_token&refresh_token=r1"),
+			RespStatus: http.StatusOK,
+			RespBody:   []byte("{\"access_token\":\"def\",\"expires_in\":1,\"refresh_token\":\"r1\"}"),
+			Times:      2,
+		},
+	)
+
+	var authorizations []string
+	var unauthorized int32
+	resource := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/expired" && atomic.AddInt32(&unauthorized, 1) == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(b)
+	}))
+	defer resource.Close()
+
+	client, err := New(
+		Host(resource.URL),
+		OAuth2ClientCredentials("http://localhost:8181/oauth/token", "id", "secret", "read", "write"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/items", "/items", "/expired"} {
+		response, err := client.Go(PUT(), Path(path), Body([]byte("ping")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if string(b) != "ping" {
+			t.Errorf("expected the body to be sent again but got (%s)", string(b))
+		}
+	}
+
+	// the token is fetched once, and again after the 401.
+	expected := "Bearer abc,Bearer abc,Bearer abc,Bearer abc"
+	if strings.Join(authorizations, ",") != expected {
+		t.Errorf("expected (%s) but got (%v)", expected, authorizations)
+	}
+
+	authorizations = nil
+	client, err = New(
+		Host(resource.URL),
+		OAuth2RefreshToken("http://localhost:8181/oauth/refresh", "id", "secret", "r1"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tokens expire within the skew so they're fetched every time.
+	for i := 0; i < 2; i++ {
+		if _, err := client.Go(GET(), Path("/items")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected = "Bearer def,Bearer def"
+	if strings.Join(authorizations, ",") != expected {
+		t.Errorf("expected (%s) but got (%v)", expected, authorizations)
+	}
+
+	// the token endpoint failure is an auth error, not the request's status.
+	_, err = client.Go(GET(), Path("/items"))
+	var ye *Yikes
+	if !errors.As(err, &ye) || ye.Kind != KindAuth || ye.StatusCode != 0 || errors.Is(err, KindStatus) {
+		t.Errorf("expected an auth error but got (%v)", err)
+	}
+
+	if !strings.Contains(err.Error(), "error 400 POST http://localhost:8181/oauth/refresh") {
+		t.Errorf("expected the token endpoint error in the message but got (%s)", err.Error())
+	}
+}
+
+func TestAuth(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s|%s", r.Header.Get("Authorization"), r.Header.Get("X-API-Key"), r.URL.RawQuery)
+	}))
+	defer server.Close()
+
+	got := func(client *Yarc, optsFunc ...optionFunc) string {
+		response, err := client.Go(optsFunc...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		b, _ := ioutil.ReadAll(response.Body)
+		return string(b)
+	}
+
+	var calls int32
+	rotating := TokenFunc(func(ctx context.Context) (string, error) {
+		return fmt.Sprintf("t%d", atomic.AddInt32(&calls, 1)), nil
+	})
+
+	client, err := New(Host(server.URL), GET(), BearerToken(rotating))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a, b := got(client), got(client); a != "Bearer t1||" || b != "Bearer t2||" {
+		t.Errorf("expected the token to be asked for every request but got (%s %s)", a, b)
+	}
+
+	t.Setenv("YARC_API_KEY", "env")
+	client, err = New(Host(server.URL), GET(), APIKey(InHeader, "X-API-Key", EnvToken("YARC_API_KEY")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r := got(client); r != "|env|" {
+		t.Errorf("expected (|env|) but got (%s)", r)
+	}
+
+	path := t.TempDir() + "/key"
+	if err := ioutil.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err = New(Host(server.URL), GET(), APIKey(InQuery, "api_key", FileToken(path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r := got(client, Query("q", "a b")); r != "||q=a+b&api_key=first" {
+		t.Errorf("expected (||q=a+b&api_key=first) but got (%s)", r)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("rotated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := got(client); r != "||api_key=rotated" {
+		t.Errorf("expected (||api_key=rotated) but got (%s)", r)
+	}
+
+	cache := &recordingCache{}
+	client, err = New(Host(server.URL), GET(), Path("/items"), WithCache(cache), APIKey(InQuery, "api_key", FileToken(path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r := got(client); r != "||api_key=rotated" {
+		t.Errorf("expected (||api_key=rotated) but got (%s)", r)
+	}
+
+	if len(cache.urls) != 1 || cache.urls[0] != server.URL+"/items" {
+		t.Errorf("expected the query key to be left out of the cache key but got (%v)", cache.urls)
+	}
+
+	client, err = New(Host(server.URL), GET(), BearerToken(EnvToken("YARC_MISSING_KEY")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Go()
+	if !errors.Is(err, KindAuth) || !strings.Contains(err.Error(), "YARC_MISSING_KEY") {
+		t.Errorf("expected the provider error but got (%v)", err)
+	}
+}
+
+func TestSigV4(t *testing.T) {
+
+	signer := SigV4{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+		Service:         "service",
+		Now: func() time.Time {
+			return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+		},
+	}
+
+	// from the AWS SigV4 test suite.
+	cases := []struct {
+		url       string
+		signature string
+	}{
+		{url: "https://example.amazonaws.com/", signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{url: "https://example.amazonaws.com/?Param2=value2&Param1=value1", signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodGet, c.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := signer.Sign(req, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + c.signature
+		if req.Header.Get("Authorization") != expected || req.Header.Get("X-Amz-Date") != "20150830T123600Z" {
+			t.Errorf("%s: expected (%s) but got (%s)", c.url, expected, req.Header.Get("Authorization"))
+		}
+	}
+
+	// from the AWS SigV4 docs and the get-space vector of the test suite.
+	paths := []struct {
+		url      string
+		double   bool
+		expected string
+	}{
+		{url: "https://example.amazonaws.com/documents%20and%20settings/", double: true, expected: "/documents%2520and%2520settings/"},
+		{url: "https://example.amazonaws.com/example%20space/", double: false, expected: "/example%20space/"},
+	}
+
+	for _, p := range paths {
+		u, err := url.Parse(p.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if path := canonicalPath(u, p.double); path != p.expected {
+			t.Errorf("%s: expected canonical path (%s) but got (%s)", p.url, p.expected, path)
+		}
+	}
+	client, err := New(Host("http://localhost:8181"), Sign(SigV4{Region: "us-east-1", Service: "service"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Go(Path("/"))
+	if y, ok := err.(*Yikes); !ok || y.Kind != KindAuth {
+		t.Errorf("expected a KindAuth Yikes without credentials but got (%v)", err)
+	}
+}
+
+func TestSign_HMAC(t *testing.T) {
+
+	secret := []byte("secret")
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		hash := sha256.Sum256(body)
+
+		canonical := strings.Join([]string{
+			r.Method,
+			r.URL.Path,
+			"a=1&b=x%20y",
+			"content-type:" + r.Header.Get("Content-Type"),
+			"host:" + r.Host,
+			"x-content-sha256:" + hex.EncodeToString(hash[:]),
+			"x-date:" + r.Header.Get("X-Date"),
+			"",
+			"content-type;host;x-content-sha256;x-date",
+			hex.EncodeToString(hash[:]),
+		}, "\n")
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(r.Header.Get("X-Date") + "\n" + canonical))
+		expected := "HMAC-SHA256 KeyId=key, SignedHeaders=content-type;host;x-content-sha256;x-date, Signature=" + hex.EncodeToString(mac.Sum(nil))
+
+		if r.Header.Get("Authorization") != expected || r.Header.Get("X-Date") != "2015-08-30T12:36:00Z" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, "expected (%s) but got (%s)", expected, r.Header.Get("Authorization"))
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(
+		Host(server.URL),
+		Sign(HMAC{KeyID: "key", Secret: secret, Headers: []string{"Content-Type"}, Now: func() time.Time { return now }}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reason string
+	_, err = client.Go(POST(), Path("/items"), Query("b", "x y"), Query("a", "1"), JSON(map[string]string{"id": "1"}), ToJSON(nil, &reason))
+	if err != nil {
+		t.Errorf("expected the request to be signed but got (%v)", err)
+	}
+}
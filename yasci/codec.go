@@ -0,0 +1,30 @@
+package yasci
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// Codec compresses stored bodies. It is shaped after compress/* packages so
+// any stdlib compatible codec (gzip, zlib, zstd ports, etc) fits in a few lines.
+type Codec interface {
+	Encode(w io.Writer) (io.WriteCloser, error)
+	Decode(r io.Reader) (io.ReadCloser, error)
+}
+
+type gzipCodec struct {
+	level int
+}
+
+// Gzip is a Codec using compress/gzip at level.
+func Gzip(level int) Codec {
+	return gzipCodec{level: level}
+}
+
+func (g gzipCodec) Encode(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, g.level)
+}
+
+func (g gzipCodec) Decode(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
@@ -0,0 +1,143 @@
+package yasci
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// Policy is the eviction policy used when yasci is full.
+type Policy int
+
+const (
+	// LRU evicts the least recently used entry.
+	LRU Policy = iota
+	// LFU evicts the least frequently used entry,
+	// the least recently used one among ties.
+	LFU
+)
+
+// evictor keeps track of key usage and chooses which key to evict.
+// It is not goroutine safe, yasci calls it holding its lock.
+type evictor interface {
+	add(key string)
+	touch(key string)
+	remove(key string)
+	victim() (string, bool)
+}
+
+func (p Policy) evictor() evictor {
+	if p == LFU {
+		return &lfu{items: make(map[string]*lfuItem)}
+	}
+
+	return &lru{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+type lru struct {
+	order *list.List
+	items map[string]*list.Element
+}
+
+func (l *lru) add(key string) {
+	if el, ok := l.items[key]; ok {
+		l.order.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.order.PushFront(key)
+}
+
+func (l *lru) touch(key string) {
+	if el, ok := l.items[key]; ok {
+		l.order.MoveToFront(el)
+	}
+}
+
+func (l *lru) remove(key string) {
+	if el, ok := l.items[key]; ok {
+		l.order.Remove(el)
+		delete(l.items, key)
+	}
+}
+
+func (l *lru) victim() (string, bool) {
+	el := l.order.Back()
+	if el == nil {
+		return "", false
+	}
+	return el.Value.(string), true
+}
+
+type lfuItem struct {
+	key   string
+	freq  int
+	tick  int
+	index int
+}
+
+// lfu is a min heap by frequency and then by last use.
+type lfu struct {
+	heap  []*lfuItem
+	items map[string]*lfuItem
+	tick  int
+}
+
+func (l *lfu) add(key string) {
+	l.tick++
+	if it, ok := l.items[key]; ok {
+		it.freq++
+		it.tick = l.tick
+		heap.Fix(l, it.index)
+		return
+	}
+	it := &lfuItem{key: key, freq: 1, tick: l.tick}
+	l.items[key] = it
+	heap.Push(l, it)
+}
+
+func (l *lfu) touch(key string) {
+	if _, ok := l.items[key]; ok {
+		l.add(key)
+	}
+}
+
+func (l *lfu) remove(key string) {
+	if it, ok := l.items[key]; ok {
+		heap.Remove(l, it.index)
+		delete(l.items, key)
+	}
+}
+
+func (l *lfu) victim() (string, bool) {
+	if len(l.heap) == 0 {
+		return "", false
+	}
+	return l.heap[0].key, true
+}
+
+func (l *lfu) Len() int { return len(l.heap) }
+
+func (l *lfu) Less(i, j int) bool {
+	if l.heap[i].freq == l.heap[j].freq {
+		return l.heap[i].tick < l.heap[j].tick
+	}
+	return l.heap[i].freq < l.heap[j].freq
+}
+
+func (l *lfu) Swap(i, j int) {
+	l.heap[i], l.heap[j] = l.heap[j], l.heap[i]
+	l.heap[i].index = i
+	l.heap[j].index = j
+}
+
+func (l *lfu) Push(x interface{}) {
+	it := x.(*lfuItem)
+	it.index = len(l.heap)
+	l.heap = append(l.heap, it)
+}
+
+func (l *lfu) Pop() interface{} {
+	old := l.heap
+	it := old[len(old)-1]
+	l.heap = old[:len(old)-1]
+	return it
+}
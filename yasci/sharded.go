@@ -0,0 +1,86 @@
+package yasci
+
+import (
+	"hash/fnv"
+	"net/http"
+	"time"
+)
+
+// sharded splits entries between several yasci shards, each one with
+// its own lock, so concurrent requests for different urls don't contend.
+type sharded struct {
+	shards []*stupid
+}
+
+// NewSharded returns a yasci split in n shards by url.
+// size and MaxBytes are split evenly between shards so each
+// shard evicts on its own.
+func NewSharded(n int, ttl time.Duration, size int, opts ...Option) *sharded {
+	if n < 1 {
+		n = 1
+	}
+
+	s := &sharded{shards: make([]*stupid, n)}
+	for i := range s.shards {
+		shard := New(ttl, (size+n-1)/n, opts...)
+		shard.maxBytes = (shard.maxBytes + int64(n) - 1) / int64(n)
+		s.shards[i] = shard
+	}
+
+	return s
+}
+
+func (s *sharded) shard(key *http.Request) *stupid {
+	h := fnv.New32a()
+	h.Write([]byte(key.URL.String()))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+func (s *sharded) Get(key *http.Request) (*http.Response, error) {
+	return s.shard(key).Get(key)
+}
+
+func (s *sharded) Set(key *http.Request, response *http.Response) error {
+	return s.shard(key).Set(key, response)
+}
+
+func (s *sharded) SetUntil(key *http.Request, response *http.Response, expiration time.Time) error {
+	return s.shard(key).SetUntil(key, response, expiration)
+}
+
+func (s *sharded) Stale(key *http.Request) (*http.Response, error) {
+	return s.shard(key).Stale(key)
+}
+
+func (s *sharded) Revalidated(key *http.Request, response *http.Response) (*http.Response, error) {
+	return s.shard(key).Revalidated(key, response)
+}
+
+func (s *sharded) ServeStale(key *http.Request, stale *http.Response) bool {
+	return s.shard(key).ServeStale(key, stale)
+}
+
+func (s *sharded) ServeStaleOnError(key *http.Request, stale *http.Response) bool {
+	return s.shard(key).ServeStaleOnError(key, stale)
+}
+
+// Stats returns the sum of every shard counters.
+func (s *sharded) Stats() Stats {
+	var stats Stats
+	for _, shard := range s.shards {
+		st := shard.Stats()
+		stats.Hits += st.Hits
+		stats.Misses += st.Misses
+		stats.Evictions += st.Evictions
+		stats.Entries += st.Entries
+		stats.Bytes += st.Bytes
+	}
+	return stats
+}
+
+// Close stops every shard janitor, if any.
+func (s *sharded) Close() {
+	for _, shard := range s.shards {
+		shard.Close()
+	}
+}
@@ -2,64 +2,251 @@ package yasci
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/tinchogob/yarc"
 )
 
 type stupid struct {
-	cache map[string]value
-	lock  *sync.RWMutex
-	ttl   time.Duration
-	size  int
+	// hits and misses are updated atomically so fresh hits only need the read lock
+	hits                 int64
+	misses               int64
+	cache                map[string]value
+	refreshing           map[string]time.Time
+	lock                 *sync.RWMutex
+	ttl                  time.Duration
+	size                 int
+	maxBytes             int64
+	bytes                int64
+	policy               Policy
+	evictor              evictor
+	janitor              time.Duration
+	stop                 chan struct{}
+	stats                Stats
+	negative             map[int]bool
+	negativeTTL          time.Duration
+	codec                Codec
+	threshold            int
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+}
+
+// Stats are yasci usage counters.
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int
+	Bytes     int64
+}
+
+// Option configures optional yasci behaviour.
+type Option func(*stupid)
+
+// Eviction sets the policy used to make room when the cache is full.
+// Default is LRU.
+func Eviction(policy Policy) Option {
+	return func(e *stupid) {
+		e.policy = policy
+	}
+}
+
+// MaxBytes bounds the stored bytes (bodies, headers and urls) on top of the
+// max number of entries. Responses bigger than max are not cached.
+func MaxBytes(max int64) Option {
+	return func(e *stupid) {
+		e.maxBytes = max
+	}
+}
+
+// Janitor purges expired entries every interval in background.
+// Use Close to stop it.
+func Janitor(interval time.Duration) Option {
+	return func(e *stupid) {
+		e.janitor = interval
+	}
+}
+
+// Negative makes yasci cache responses with any of statuses
+// (such as 404 or 410) for ttl, usually shorter than the one for
+// successful responses, so missing items don't hit upstream every time.
+func Negative(ttl time.Duration, statuses ...int) Option {
+	return func(e *stupid) {
+		e.negativeTTL = ttl
+		e.negative = make(map[int]bool)
+		for _, status := range statuses {
+			e.negative[status] = true
+		}
+	}
+}
+
+// Compress stores bodies of at least threshold bytes compressed with codec.
+// They are decompressed on every hit, trading cpu for memory.
+func Compress(codec Codec, threshold int) Option {
+	return func(e *stupid) {
+		e.codec = codec
+		e.threshold = threshold
+	}
+}
+
+// StaleWhileRevalidate makes yasci answer with entries expired for up to
+// max while yarc refreshes them in background.
+// Only one refresh per entry runs at a time.
+func StaleWhileRevalidate(max time.Duration) Option {
+	return func(e *stupid) {
+		e.staleWhileRevalidate = max
+	}
+}
+
+// StaleIfError makes yasci answer with entries expired for up to max when
+// upstream fails with a transport error or a 5xx response.
+func StaleIfError(max time.Duration) Option {
+	return func(e *stupid) {
+		e.staleIfError = max
+	}
 }
 
 type value struct {
-	expiration time.Time
-	status     int
-	url        string
-	body       []byte
+	stored        time.Time
+	expiration    time.Time
+	status        int
+	url           string
+	proto         string
+	protoMajor    int
+	protoMinor    int
+	header        http.Header
+	trailer       http.Header
+	contentLength int64
+	compressed    bool
+	body          []byte
+}
+
+// Yet Anothed (stupid) cache implementation.
+// It holds up to size entries for ttl, evicting as defined by its Policy.
+func New(ttl time.Duration, size int, opts ...Option) *stupid {
+	e := &stupid{
+		cache:      make(map[string]value),
+		refreshing: make(map[string]time.Time),
+		lock:       new(sync.RWMutex),
+		ttl:        ttl,
+		size:       size,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	e.evictor = e.policy.evictor()
+
+	if e.janitor > 0 {
+		e.stop = make(chan struct{})
+		go e.clean()
+	}
+
+	return e
+}
+
+// Stats returns a snapshot of the cache counters.
+func (e *stupid) Stats() Stats {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	stats := e.stats
+	stats.Hits = atomic.LoadInt64(&e.hits)
+	stats.Misses = atomic.LoadInt64(&e.misses)
+	stats.Entries = len(e.cache)
+	stats.Bytes = e.bytes
+	return stats
 }
 
-// Yet Anothed (stupid) cache implementation
-func New(ttl time.Duration, size int) *stupid {
-	return &stupid{
-		cache: make(map[string]value),
-		lock:  new(sync.RWMutex),
-		ttl:   ttl,
-		size:  size,
+// Close stops the janitor, if any.
+func (e *stupid) Close() {
+	if e.stop != nil {
+		close(e.stop)
+	}
+}
+
+func (e *stupid) clean() {
+	ticker := time.NewTicker(e.janitor)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case now := <-ticker.C:
+			e.lock.Lock()
+			for k, v := range e.cache {
+				if v.expiration.Before(now) && !e.usable(v) {
+					e.remove(k)
+				}
+			}
+			e.lock.Unlock()
+		}
 	}
 }
 
 func (e *stupid) Get(key *http.Request) (*http.Response, error) {
+	v, ok := e.get(key.URL.String())
+	if !ok {
+		return nil, nil
+	}
+
+	return e.response(v, key)
+}
+
+// get returns the fresh entry for url, keeping counters and eviction up to date.
+// Lookups only take the read lock so readers of the same url don't wait on
+// each other. The recency of a hit is updated only if the write lock is free,
+// so under contention the eviction policy sees part of the hits.
+func (e *stupid) get(url string) (value, bool) {
 	e.lock.RLock()
-	v := e.cache[key.URL.String()]
+	v := e.cache[url]
 	e.lock.RUnlock()
 
 	if v.url == "" {
-		return nil, nil
+		atomic.AddInt64(&e.misses, 1)
+		return v, false
 	}
 
 	if v.expiration.Before(time.Now()) {
-		e.lock.Lock()
-		delete(e.cache, key.URL.String())
-		e.size--
-		e.lock.Unlock()
-		return nil, nil
+		// expired entries are kept while they can still be revalidated or served stale
+		if !e.usable(v) {
+			e.lock.Lock()
+			if current, ok := e.cache[url]; ok && current.stored.Equal(v.stored) {
+				e.remove(url)
+			}
+			e.lock.Unlock()
+		}
+		atomic.AddInt64(&e.misses, 1)
+		return v, false
 	}
 
-	r := &http.Response{
-		Status:     http.StatusText(v.status),
-		StatusCode: v.status,
-		Request:    key,
-		Body:       ioutil.NopCloser(bytes.NewBuffer(v.body)),
+	if e.lock.TryLock() {
+		e.evictor.touch(url)
+		e.lock.Unlock()
 	}
-
-	return r, nil
+	atomic.AddInt64(&e.hits, 1)
+	return v, true
 }
 
 func (e *stupid) Set(key *http.Request, response *http.Response) error {
+	return e.set(key, response, time.Time{})
+}
+
+// SetUntil stores response like Set but expires it at expiration if that's
+// earlier than its ttl, so entries copied from another cache don't outlive it.
+func (e *stupid) SetUntil(key *http.Request, response *http.Response, expiration time.Time) error {
+	return e.set(key, response, expiration)
+}
+
+func (e *stupid) set(key *http.Request, response *http.Response, until time.Time) error {
 
 	if !e.shouldSet(key, response) {
 		return nil
@@ -73,28 +260,171 @@ func (e *stupid) Set(key *http.Request, response *http.Response) error {
 
 	response.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 
+	contentLength := int64(len(body))
+	compressed := false
+	if e.codec != nil && len(body) >= e.threshold {
+		body, err = e.compress(body)
+		if err != nil {
+			return err
+		}
+		compressed = true
+	}
+
+	ttl := e.ttl
+	if e.negative[response.StatusCode] {
+		ttl = e.negativeTTL
+	}
+
+	now := time.Now()
+	expiration := now.Add(ttl)
+	if !until.IsZero() && until.Before(expiration) {
+		expiration = until
+	}
+
 	v := value{
-		status:     response.StatusCode,
-		url:        key.URL.String(),
-		body:       body,
-		expiration: time.Now().Add(e.ttl),
+		stored:        now,
+		expiration:    expiration,
+		status:        response.StatusCode,
+		url:           key.URL.String(),
+		proto:         response.Proto,
+		protoMajor:    response.ProtoMajor,
+		protoMinor:    response.ProtoMinor,
+		header:        response.Header.Clone(),
+		trailer:       response.Trailer.Clone(),
+		contentLength: contentLength,
+		compressed:    compressed,
+		body:          body,
+	}
+
+	if e.maxBytes > 0 && v.bytes() > e.maxBytes {
+		return nil
 	}
 
 	e.lock.Lock()
-	e.cache[key.URL.String()] = v
-	e.size++
-	e.lock.Unlock()
+	defer e.lock.Unlock()
+
+	e.remove(v.url)
+	for len(e.cache) >= e.size || (e.maxBytes > 0 && e.bytes+v.bytes() > e.maxBytes) {
+		victim, ok := e.evictor.victim()
+		if !ok {
+			break
+		}
+		e.remove(victim)
+		e.stats.Evictions++
+	}
+
+	e.cache[v.url] = v
+	e.bytes += v.bytes()
+	e.evictor.add(v.url)
 
 	return nil
 }
 
+// remove deletes key from the cache. Callers must hold the lock.
+func (e *stupid) remove(key string) {
+	v, ok := e.cache[key]
+	if !ok {
+		return
+	}
+
+	delete(e.cache, key)
+	delete(e.refreshing, key)
+	e.evictor.remove(key)
+	e.bytes -= v.bytes()
+}
+
+// Stale returns an expired entry for key if it has an ETag or Last-Modified
+// so yarc can revalidate it with a conditional request, or if it is still
+// within the stale-while-revalidate or stale-if-error windows.
+func (e *stupid) Stale(key *http.Request) (*http.Response, error) {
+	e.lock.RLock()
+	v := e.cache[key.URL.String()]
+	e.lock.RUnlock()
+
+	if v.url == "" || !v.expiration.Before(time.Now()) || !e.usable(v) {
+		return nil, nil
+	}
+
+	return e.response(v, key)
+}
+
+// ServeStale reports whether the entry for key may be served while it is
+// refreshed in background, and marks it as refreshing.
+// A refresh that didn't make it to Set is retried after ttl.
+func (e *stupid) ServeStale(key *http.Request, stale *http.Response) bool {
+	now := time.Now()
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	v := e.cache[key.URL.String()]
+	if v.url == "" || now.After(v.expiration.Add(e.staleWhileRevalidate)) {
+		return false
+	}
+
+	if started, ok := e.refreshing[key.URL.String()]; ok && now.Before(started.Add(e.ttl)) {
+		return false
+	}
+
+	e.refreshing[key.URL.String()] = now
+	return true
+}
+
+// ServeStaleOnError reports whether the entry for key may be served
+// because upstream failed.
+func (e *stupid) ServeStaleOnError(key *http.Request, stale *http.Response) bool {
+	e.lock.RLock()
+	v := e.cache[key.URL.String()]
+	e.lock.RUnlock()
+
+	return v.url != "" && !time.Now().After(v.expiration.Add(e.staleIfError))
+}
+
+// Revalidated refreshes the expiration of the entry for key after upstream
+// answered a conditional request with a 304, and returns the cached response.
+// It returns nil if the entry was evicted meanwhile.
+func (e *stupid) Revalidated(key *http.Request, response *http.Response) (*http.Response, error) {
+	e.lock.Lock()
+	v, ok := e.cache[key.URL.String()]
+	if ok {
+		// a 304 carries the headers that should be updated in the stored entry
+		header := v.header.Clone()
+		for name, values := range response.Header {
+			if name != "Content-Length" {
+				header[name] = values
+			}
+		}
+		e.bytes -= v.bytes()
+		v.header = header
+		v.stored = time.Now()
+		v.expiration = v.stored.Add(e.ttl)
+		e.bytes += v.bytes()
+		e.cache[key.URL.String()] = v
+		e.evictor.touch(key.URL.String())
+	}
+	delete(e.refreshing, key.URL.String())
+	e.lock.Unlock()
+
+	response.Body.Close()
+	if !ok {
+		return nil, nil
+	}
+
+	return e.response(v, key)
+}
+
 func (e *stupid) shouldSet(key *http.Request, response *http.Response) bool {
 
-	// If full, no cache
-	if len(e.cache) >= e.size {
+	// If there is no room at all, no cache
+	if e.size <= 0 {
 		return false
 	}
 
+	// negative caching was asked for this status
+	if e.negative[response.StatusCode] {
+		return true
+	}
+
 	// if response status is not 2xx (success), no cache
 	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
 		return false
@@ -102,3 +432,99 @@ func (e *stupid) shouldSet(key *http.Request, response *http.Response) bool {
 
 	return true
 }
+
+// usable reports whether an expired entry is still worth keeping.
+func (e *stupid) usable(v value) bool {
+	if v.revalidatable() {
+		return true
+	}
+
+	max := e.staleWhileRevalidate
+	if e.staleIfError > max {
+		max = e.staleIfError
+	}
+
+	return !time.Now().After(v.expiration.Add(max))
+}
+
+// bytes approximates the memory held by v.
+func (v value) bytes() int64 {
+	n := len(v.url) + len(v.body)
+	for name, values := range v.header {
+		n += len(name)
+		for _, value := range values {
+			n += len(value)
+		}
+	}
+	return int64(n)
+}
+
+func (v value) revalidatable() bool {
+	return v.header.Get("ETag") != "" || v.header.Get("Last-Modified") != ""
+}
+
+func (e *stupid) compress(body []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w, err := e.codec.Encode(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// response rebuilds the stored response, decompressing its body if needed.
+func (e *stupid) response(v value, key *http.Request) (*http.Response, error) {
+	if !v.compressed {
+		return v.response(key, v.body), nil
+	}
+
+	r, err := e.codec.Decode(bytes.NewReader(v.body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.response(key, body), nil
+}
+
+// response rebuilds the stored response with body. Every cached response
+// is marked with yarc.HitHeader and carries an Age header with the seconds it has
+// been stored (plus upstream's Age).
+func (v value) response(key *http.Request, body []byte) *http.Response {
+	header := v.header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	age, _ := strconv.ParseInt(header.Get("Age"), 10, 64)
+	age += int64(time.Since(v.stored) / time.Second)
+	header.Set("Age", strconv.FormatInt(age, 10))
+	header.Set(yarc.HitHeader, "hit")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", v.status, http.StatusText(v.status)),
+		StatusCode:    v.status,
+		Proto:         v.proto,
+		ProtoMajor:    v.protoMajor,
+		ProtoMinor:    v.protoMinor,
+		Header:        header,
+		Trailer:       v.trailer.Clone(),
+		ContentLength: v.contentLength,
+		Request:       key,
+		Body:          ioutil.NopCloser(bytes.NewBuffer(body)),
+	}
+}
@@ -0,0 +1,209 @@
+package yasci
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func request(url string) *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, url, nil)
+	return r
+}
+
+func response(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+	}
+}
+
+func TestYasci_Eviction(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  Policy
+		evicted string
+	}{
+		{name: "LRU", policy: LRU, evicted: "http://yarc/b"},
+		{name: "LFU", policy: LFU, evicted: "http://yarc/c"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cache := New(time.Minute, 3, Eviction(c.policy))
+
+			for _, url := range []string{"http://yarc/a", "http://yarc/b", "http://yarc/c"} {
+				if err := cache.Set(request(url), response(url)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// b is the least recently used but the most frequently used
+			// and c is the least frequently used, older than a
+			for _, url := range []string{"http://yarc/b", "http://yarc/b", "http://yarc/c", "http://yarc/a"} {
+				cache.Get(request(url))
+			}
+
+			if err := cache.Set(request("http://yarc/d"), response("d")); err != nil {
+				t.Fatal(err)
+			}
+
+			if r, _ := cache.Get(request(c.evicted)); r != nil {
+				t.Errorf("expected %s to be evicted", c.evicted)
+			}
+
+			stats := cache.Stats()
+			if stats.Evictions != 1 || stats.Entries != 3 {
+				t.Errorf("expected 1 eviction and 3 entries but got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestYasci_MaxBytes(t *testing.T) {
+	cache := New(time.Minute, 100, MaxBytes(64))
+
+	cache.Set(request("http://yarc/a"), response("0123456789012345678901234567890123456789"))
+	cache.Set(request("http://yarc/b"), response("0123456789012345678901234567890123456789"))
+	cache.Set(request("http://yarc/big"), response(string(make([]byte, 100))))
+
+	if r, _ := cache.Get(request("http://yarc/a")); r != nil {
+		t.Error("expected a to be evicted to make room for b")
+	}
+
+	if r, _ := cache.Get(request("http://yarc/big")); r != nil {
+		t.Error("expected responses bigger than max bytes not to be cached")
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 1 || stats.Bytes > 64 || stats.Hits != 0 || stats.Misses != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestYasci_Janitor(t *testing.T) {
+	cache := New(time.Millisecond, 10, Janitor(time.Millisecond*5))
+	defer cache.Close()
+
+	cache.Set(request("http://yarc/a"), response("a"))
+	time.Sleep(time.Millisecond * 30)
+
+	if stats := cache.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("expected expired entries to be purged but got %+v", stats)
+	}
+}
+
+func TestYasci_Sharded(t *testing.T) {
+	cache := NewSharded(4, time.Minute, 100)
+
+	urls := []string{"http://yarc/a", "http://yarc/b", "http://yarc/c", "http://yarc/d", "http://yarc/e"}
+	for _, url := range urls {
+		if err := cache.Set(request(url), response(url)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, url := range urls {
+		r, err := cache.Get(request(url))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if r == nil {
+			t.Fatalf("expected a hit for %s", url)
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != url {
+			t.Errorf("expected (%s) but got (%s)", url, string(body))
+		}
+	}
+
+	if stats := cache.Stats(); stats.Hits != 5 || stats.Entries != 5 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func BenchmarkYasci_Parallel(b *testing.B) {
+	type cache interface {
+		Get(key *http.Request) (*http.Response, error)
+		Set(key *http.Request, response *http.Response) error
+	}
+
+	caches := []struct {
+		name string
+		new  func() cache
+	}{
+		{name: "Single", new: func() cache { return New(time.Minute, 1000) }},
+		{name: "Sharded", new: func() cache { return NewSharded(32, time.Minute, 1000) }},
+	}
+
+	requests := make([]*http.Request, 1000)
+	for i := range requests {
+		requests[i] = request(fmt.Sprintf("http://yarc/items/%d", i))
+	}
+
+	for _, c := range caches {
+		b.Run(c.name, func(b *testing.B) {
+			cache := c.new()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					r := requests[i%len(requests)]
+					// one Set every ten Gets
+					if i%10 == 0 {
+						cache.Set(r, response("{}"))
+					} else {
+						cache.Get(r)
+					}
+					i++
+				}
+			})
+		})
+
+		// every reader hits the same url, so sharding doesn't help
+		b.Run(c.name+"HotKey", func(b *testing.B) {
+			cache := c.new()
+			cache.Set(requests[0], response("{}"))
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					cache.Get(requests[0])
+				}
+			})
+		})
+	}
+}
+
+func TestYasci_Compress(t *testing.T) {
+	cache := New(time.Minute, 10, Compress(Gzip(gzip.BestSpeed), 1024))
+
+	large := strings.Repeat("{\"id\":\"123\",\"title\":\"yarc\"},", 500)
+	cache.Set(request("http://yarc/large"), response(large))
+	cache.Set(request("http://yarc/small"), response("{}"))
+
+	if !cache.cache["http://yarc/large"].compressed || cache.cache["http://yarc/small"].compressed {
+		t.Error("expected only bodies over the threshold to be compressed")
+	}
+
+	if stats := cache.Stats(); stats.Bytes >= int64(len(large)) {
+		t.Errorf("expected less than %d bytes stored but got %d", len(large), stats.Bytes)
+	}
+
+	for url, expected := range map[string]string{"http://yarc/large": large, "http://yarc/small": "{}"} {
+		r, err := cache.Get(request(url))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != expected || r.ContentLength != int64(len(expected)) {
+			t.Errorf("%s: expected the original body back", url)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package yatci
+
+import (
+	"sync"
+	"time"
+)
+
+type memStore struct {
+	values map[string]memValue
+	lock   *sync.RWMutex
+}
+
+type memValue struct {
+	expiration time.Time
+	value      []byte
+}
+
+// NewMemStore returns an in-process Store.
+// It is meant for tests and local development, where there is no
+// shared store to talk to.
+func NewMemStore() *memStore {
+	return &memStore{
+		values: make(map[string]memValue),
+		lock:   new(sync.RWMutex),
+	}
+}
+
+func (m *memStore) Get(key string) ([]byte, error) {
+	m.lock.RLock()
+	v, ok := m.values[key]
+	m.lock.RUnlock()
+
+	if !ok || v.expiration.Before(time.Now()) {
+		return nil, nil
+	}
+
+	return v.value, nil
+}
+
+func (m *memStore) Set(key string, value []byte, ttl time.Duration) error {
+	m.lock.Lock()
+	m.values[key] = memValue{expiration: time.Now().Add(ttl), value: value}
+	m.lock.Unlock()
+	return nil
+}
+
+func (m *memStore) Delete(key string) error {
+	m.lock.Lock()
+	delete(m.values, key)
+	m.lock.Unlock()
+	return nil
+}
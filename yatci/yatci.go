@@ -0,0 +1,140 @@
+package yatci
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"time"
+
+	"github.com/tinchogob/yarc"
+)
+
+// Store is a shared byte store such as redis or memcached.
+// Get must return nil and no error on a miss.
+type Store interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// Expirer is an optional interface l1 may implement so that entries
+// back-filled from a Remote l2 expire when they do in l2. yasci does.
+type Expirer interface {
+	SetUntil(key *http.Request, response *http.Response, expiration time.Time) error
+}
+
+type tiered struct {
+	l1 yarc.Cache
+	l2 yarc.Cache
+}
+
+// Yet Another Tiered Cache Implementation.
+// Tiered reads through l1 and then l2, back-filling l1 on l2 hits,
+// and writes to both. Usually l1 is an in-memory yasci and l2 is a
+// Remote store shared between instances.
+// Back-filled entries expire along with l2's if l1 is an Expirer,
+// otherwise l1 keeps them for its own ttl.
+func Tiered(l1 yarc.Cache, l2 yarc.Cache) *tiered {
+	return &tiered{l1: l1, l2: l2}
+}
+
+func (t *tiered) Get(key *http.Request) (*http.Response, error) {
+	response, err := t.l1.Get(key)
+	if err != nil || response != nil {
+		return response, err
+	}
+
+	var expiration time.Time
+	if r, ok := t.l2.(*remote); ok {
+		response, expiration, err = r.get(key)
+	} else {
+		response, err = t.l2.Get(key)
+	}
+	if err != nil || response == nil {
+		return response, err
+	}
+
+	// back-filling is best effort, the l2 hit is good anyway
+	if e, ok := t.l1.(Expirer); ok && !expiration.IsZero() {
+		e.SetUntil(key, response, expiration)
+	} else {
+		t.l1.Set(key, response)
+	}
+
+	return response, nil
+}
+
+func (t *tiered) Set(key *http.Request, response *http.Response) error {
+	err := t.l1.Set(key, response)
+	if err != nil {
+		return err
+	}
+
+	return t.l2.Set(key, response)
+}
+
+type remote struct {
+	store Store
+	ttl   time.Duration
+}
+
+// Remote is a yarc.Cache that keeps responses in store for ttl.
+// Responses are stored in HTTP wire format keyed by url.
+func Remote(store Store, ttl time.Duration) *remote {
+	return &remote{store: store, ttl: ttl}
+}
+
+func (r *remote) Get(key *http.Request) (*http.Response, error) {
+	response, _, err := r.get(key)
+	return response, err
+}
+
+// get returns the stored response for key and when it expires.
+func (r *remote) get(key *http.Request) (*http.Response, time.Time, error) {
+	b, err := r.store.Get(key.URL.String())
+	if err != nil || b == nil {
+		return nil, time.Time{}, err
+	}
+
+	// values that aren't "<stored>\n<response>" are deleted, Set will replace them
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 {
+		return nil, time.Time{}, r.store.Delete(key.URL.String())
+	}
+
+	stored, err := strconv.ParseInt(string(b[:i]), 10, 64)
+	if err != nil {
+		return nil, time.Time{}, r.store.Delete(key.URL.String())
+	}
+
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b[i+1:])), key)
+	if err != nil {
+		return nil, time.Time{}, r.store.Delete(key.URL.String())
+	}
+
+	age, _ := strconv.ParseInt(response.Header.Get("Age"), 10, 64)
+	age += int64(time.Since(time.Unix(0, stored)) / time.Second)
+	response.Header.Set("Age", strconv.FormatInt(age, 10))
+	response.Header.Set(yarc.HitHeader, "hit")
+
+	return response, time.Unix(0, stored).Add(r.ttl), nil
+}
+
+func (r *remote) Set(key *http.Request, response *http.Response) error {
+
+	// non 2xx responses aren't shared
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return nil
+	}
+
+	dump, err := httputil.DumpResponse(response, true)
+	if err != nil {
+		return err
+	}
+
+	b := append([]byte(fmt.Sprintf("%d\n", time.Now().UnixNano())), dump...)
+	return r.store.Set(key.URL.String(), b, r.ttl)
+}
@@ -0,0 +1,119 @@
+package yatci
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tinchogob/yarc/yasci"
+)
+
+func request(url string) *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, url, nil)
+	return r
+}
+
+func response(body string) *http.Response {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		ContentLength: int64(len(body)),
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+	}
+}
+
+func TestTiered(t *testing.T) {
+	store := NewMemStore()
+
+	// one instance caches the response in both tiers
+	first := Tiered(yasci.New(time.Minute, 10), Remote(store, time.Minute))
+	res := response("{\"id\":\"123\"}")
+	if err := first.Set(request("http://yarc/items/123"), res); err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := ioutil.ReadAll(res.Body); string(body) != "{\"id\":\"123\"}" {
+		t.Errorf("expected Set to leave the body readable but got (%s)", string(body))
+	}
+
+	// another one finds it in the shared store and back-fills its l1
+	l1 := yasci.New(time.Minute, 10)
+	second := Tiered(l1, Remote(store, time.Minute))
+
+	hit, err := second.Get(request("http://yarc/items/123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hit == nil {
+		t.Fatal("expected a hit from l2")
+	}
+
+	body, _ := ioutil.ReadAll(hit.Body)
+	if string(body) != "{\"id\":\"123\"}" || hit.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected ({\"id\":\"123\"} application/json) but got (%s %s)", string(body), hit.Header.Get("Content-Type"))
+	}
+
+	if l1hit, _ := l1.Get(request("http://yarc/items/123")); l1hit == nil {
+		t.Error("expected l1 to be back-filled")
+	}
+}
+
+func TestRemote_Corrupted(t *testing.T) {
+	store := NewMemStore()
+	store.Set("http://yarc/items/123", []byte("not a response"), time.Minute)
+
+	hit, err := Remote(store, time.Minute).Get(request("http://yarc/items/123"))
+	if err != nil || hit != nil {
+		t.Errorf("expected a miss but got (%v %v)", hit, err)
+	}
+
+	if b, _ := store.Get("http://yarc/items/123"); b != nil {
+		t.Error("expected corrupted entry to be deleted")
+	}
+}
+
+// brokenCache misses every Get and fails every Set.
+type brokenCache struct{}
+
+func (brokenCache) Get(key *http.Request) (*http.Response, error) {
+	return nil, nil
+}
+
+func (brokenCache) Set(key *http.Request, response *http.Response) error {
+	return errors.New("l1 is full")
+}
+
+func TestTiered_BackFill(t *testing.T) {
+	store := NewMemStore()
+	l2 := Remote(store, time.Millisecond*50)
+	if err := l2.Set(request("http://yarc/items/123"), response("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed back-fill doesn't lose the l2 hit
+	hit, err := Tiered(brokenCache{}, l2).Get(request("http://yarc/items/123"))
+	if err != nil || hit == nil {
+		t.Errorf("expected the l2 hit but got (%v %v)", hit, err)
+	}
+
+	// back-filled entries expire along with l2's, not after l1's ttl
+	l1 := yasci.New(time.Minute, 10)
+	if hit, _ := Tiered(l1, l2).Get(request("http://yarc/items/123")); hit == nil {
+		t.Fatal("expected a hit from l2")
+	}
+
+	if hit, _ := l1.Get(request("http://yarc/items/123")); hit == nil {
+		t.Error("expected l1 to be back-filled")
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	if hit, _ := l1.Get(request("http://yarc/items/123")); hit != nil {
+		t.Error("expected the back-filled entry to expire with l2")
+	}
+}
@@ -0,0 +1,128 @@
+package yarc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Kind classifies a Yikes by where the request failed.
+// Kinds are errors themselves so they can be used as sentinels:
+//
+//	if errors.Is(err, yarc.KindTimeout) { ... }
+type Kind string
+
+const (
+	// KindOption means an option function (or trace builder) failed.
+	KindOption Kind = "option"
+	// KindURL means the request couldn't be built from its url.
+	KindURL Kind = "url"
+	// KindTransport means the request couldn't be sent or answered.
+	KindTransport Kind = "transport"
+	// KindTimeout means the request timed out or its context deadline passed.
+	KindTimeout Kind = "timeout"
+	// KindAuth means the request's credentials couldn't be obtained
+	// or the request couldn't be signed.
+	KindAuth Kind = "auth"
+	// KindCache means the Cache failed.
+	KindCache Kind = "cache"
+	// KindHook means an After function rejected the response.
+	KindHook Kind = "hook"
+	// KindDecode means the response body couldn't be decoded.
+	KindDecode Kind = "decode"
+	// KindStatus means upstream answered with an unsuccessful status.
+	KindStatus Kind = "status"
+)
+
+func (k Kind) Error() string {
+	return "yarc: " + string(k) + " error"
+}
+
+// Yikes is yarc's error implementation. Since every unsuccessful response (non 2xx
+// unless told otherwise) is considered an error yikes carries the response body if available.
+// Method, URL and Attempts are set once the request is built and
+// StatusCode once there's a response.
+// Problem is set when an unsuccessful response is an application/problem+json,
+// even if ToJSON had no errBody to decode it to.
+type Yikes struct {
+	Kind       Kind
+	StatusCode int
+	Method     string
+	URL        string
+	Attempts   int
+	Cause      error
+	Body       interface{}
+	Problem    *Problem
+}
+
+func (ye Yikes) Error() string {
+	switch {
+	case ye.Kind == KindStatus:
+		return fmt.Sprintf("error %d %s %s", ye.StatusCode, ye.Method, ye.URL)
+	case ye.Kind == KindDecode && ye.Cause != nil:
+		return fmt.Sprintf("error %d %s %s %s", ye.StatusCode, ye.Method, ye.URL, ye.Cause.Error())
+	case ye.Cause != nil:
+		return ye.Cause.Error()
+	default:
+		return ye.Kind.Error()
+	}
+}
+
+// Unwrap returns the error that caused ye, if any.
+func (ye Yikes) Unwrap() error {
+	return ye.Cause
+}
+
+// Is reports whether target is ye's Kind.
+func (ye Yikes) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == ye.Kind
+}
+
+// cacheError flags errors coming from the Cache
+// as they travel through middlewares.
+type cacheError struct {
+	error
+}
+
+func (c cacheError) Unwrap() error {
+	return c.error
+}
+
+// authError flags errors obtaining credentials
+// as they travel through middlewares.
+type authError struct {
+	error
+}
+
+func (a authError) Unwrap() error {
+	return a.error
+}
+
+func unwrapCache(err error) error {
+	var c cacheError
+	if errors.As(err, &c) {
+		return c.error
+	}
+	return err
+}
+
+func kindOf(err error) Kind {
+	var c cacheError
+	if errors.As(err, &c) {
+		return KindCache
+	}
+
+	var a authError
+	if errors.As(err, &a) {
+		return KindAuth
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return KindTimeout
+	}
+
+	return KindTransport
+}